@@ -40,17 +40,17 @@ func (m *MiddlewareBuilder) Build() web.Middleware {
 			startTime := time.Now()
 			next(ctx)
 			endTime := time.Now()
-			go report(endTime.Sub(startTime), ctx, vector)
+			// Context 在 handler 返回之后会被复用，所以先取出需要的数据
+			route := "unknown"
+			if ctx.Route != "" {
+				route = ctx.Route
+			}
+			go report(endTime.Sub(startTime), route, ctx.Req.Method, ctx.RespStatusCode, vector)
 		}
 	}
 }
 
-func report(dur time.Duration, ctx *web.Context, vec prometheus.ObserverVec) {
-	status := ctx.RespStatusCode
-	route := "unknown"
-	if ctx.Route != "" {
-		route = ctx.Route
-	}
+func report(dur time.Duration, route string, method string, status int, vec prometheus.ObserverVec) {
 	ms := dur / time.Millisecond
-	vec.WithLabelValues(route, ctx.Req.Method, strconv.Itoa(status)).Observe(float64(ms))
+	vec.WithLabelValues(route, method, strconv.Itoa(status)).Observe(float64(ms))
 }
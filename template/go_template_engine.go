@@ -3,7 +3,9 @@ package template
 import (
 	"bytes"
 	"context"
+	"errors"
 	"html/template"
+	"leason-toy-web/web"
 )
 
 type GoTemplateEngine struct {
@@ -18,3 +20,20 @@ func (g *GoTemplateEngine) Render(ctx context.Context, tplName string, data any)
 	}
 	return bs.Bytes(), nil
 }
+
+// Funcs 注册模板函数，会覆盖解析模板时使用的同名占位函数
+func (g *GoTemplateEngine) Funcs(funcs map[string]any) {
+	g.T.Funcs(funcs)
+}
+
+// PlaceholderFuncs 返回 web 提供的模板函数的占位实现
+// 解析模板之前注册，例如
+// template.New("").Funcs(PlaceholderFuncs()).ParseGlob("*.gohtml")
+// 创建 HTTPServer 的时候会替换为真正的实现
+func PlaceholderFuncs() template.FuncMap {
+	return template.FuncMap{
+		web.URLFuncName: func(name string, kvs ...string) (string, error) {
+			return "", errors.New("template: url 函数尚未注册")
+		},
+	}
+}
@@ -0,0 +1,157 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WrapHandler 把 http.Handler 适配为 HandleFunc
+// h 写入的响应码和响应体会被记录到 RespStatusCode 和 RespData 中，
+// 由 HTTPServer 统一写回，所以 middleware 依旧能够看到并修改响应；
+// 响应头直接写入 ctx.Resp.Header()
+func WrapHandler(h http.Handler) HandleFunc {
+	return func(ctx *Context) {
+		h.ServeHTTP(&respRecorder{ctx: ctx}, ctx.Req)
+	}
+}
+
+// WrapHandlerFunc 把 http.HandlerFunc 适配为 HandleFunc
+func WrapHandlerFunc(h http.HandlerFunc) HandleFunc {
+	return WrapHandler(h)
+}
+
+// WrapMiddleware 把 net/http 风格的 middleware 适配为 Middleware
+// mw 可以替换 *http.Request 和 http.ResponseWriter，
+// 后续的 middleware 和 handler 看到的是替换之后的 Req 和 Resp，
+// 它们的响应会直接写入 mw 提供的 http.ResponseWriter
+func WrapMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			resp := ctx.Resp
+			h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// mw 提供的 w 可能会缓冲响应，例如 gzip，
+				// 所以要记录的是 handler 有没有往 w 里面写，而不是 ctx.writer
+				ww := &wroteWriter{ResponseWriter: w}
+				ctx.Req = r
+				ctx.Resp = ww
+				next(ctx)
+				// handler 已经直接写出了响应，或者接管了连接
+				if !ww.wrote {
+					ctx.Resp = w
+					writeResp(ctx)
+				}
+				ctx.Resp = resp
+			}))
+			h.ServeHTTP(resp, ctx.Req)
+		}
+	}
+}
+
+// Mount 把 h 挂载到 prefix 下，prefix 以及 prefix 下的所有路径都交给 h 处理
+// h 看到的请求路径去掉了 prefix，例如挂载在 /debug 下的时候，
+// /debug/pprof/ 在 h 看来是 /pprof/
+// h 可以是另外一个 HTTPServer，也可以是任意的 http.Handler
+func (s *HTTPServer) Mount(prefix string, h http.Handler) {
+	s.validatePath(prefix)
+	handler := WrapHandler(stripPrefix(prefix, h))
+	s.Any(prefix, handler)
+	if prefix == "/" {
+		s.Any("/*", handler)
+		return
+	}
+	s.Any(prefix+"/*", handler)
+}
+
+// stripPrefix 和 http.StripPrefix 类似，区别在于去掉前缀之后的路径为空的时候使用 /，
+// 并且前缀不匹配的时候原样交给 h 处理
+func stripPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "/" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		rp := strings.TrimPrefix(r.URL.RawPath, prefix)
+		if p == "" {
+			p = "/"
+		}
+		if rp == "" && r.URL.RawPath != "" {
+			rp = "/"
+		}
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = rp
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// wroteWriter 记录是否写入过响应，或者接管了连接
+type wroteWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (w *wroteWriter) WriteHeader(statusCode int) {
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *wroteWriter) Write(data []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush 底层不支持的时候什么也不做
+func (w *wroteWriter) Flush() {
+	w.wrote = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *wroteWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("web: 底层的 http.ResponseWriter 不支持 Hijack")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.wrote = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回底层的 http.ResponseWriter，供 http.ResponseController 使用
+func (w *wroteWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// respRecorder 把写入的响应记录到 Context 中
+type respRecorder struct {
+	ctx         *Context
+	wroteHeader bool
+}
+
+func (r *respRecorder) Header() http.Header {
+	return r.ctx.Resp.Header()
+}
+
+func (r *respRecorder) Write(data []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	r.ctx.RespData = append(r.ctx.RespData, data...)
+	return len(data), nil
+}
+
+func (r *respRecorder) WriteHeader(statusCode int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.ctx.RespStatusCode = statusCode
+}
@@ -0,0 +1,181 @@
+package web
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrapHandler(t *testing.T) {
+	s := NewHTTPServer()
+	var status int
+	s.Use(http.MethodGet, "/", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			status = ctx.RespStatusCode
+		}
+	})
+	s.Get("/teapot", WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "wrap")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("hello "))
+		_, _ = w.Write([]byte("world"))
+	}))
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/teapot", nil))
+	assert.Equal(t, http.StatusTeapot, recorder.Code)
+	assert.Equal(t, "hello world", recorder.Body.String())
+	assert.Equal(t, "wrap", recorder.Header().Get("X-Test"))
+	assert.Equal(t, http.StatusTeapot, status)
+}
+
+func TestWrapMiddleware(t *testing.T) {
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("X-Auth", "ok")
+			next.ServeHTTP(w, r)
+		})
+	}
+	s := NewHTTPServer(ServerWithMiddleware(WrapMiddleware(mw)))
+	s.Get("/user", func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusCreated
+		ctx.RespData = []byte("user")
+	})
+
+	testCases := []struct {
+		name     string
+		auth     string
+		wantCode int
+		wantBody string
+		wantAuth string
+	}{
+		{
+			name:     "pass",
+			auth:     "token",
+			wantCode: http.StatusCreated,
+			wantBody: "user",
+			wantAuth: "ok",
+		},
+		{
+			name:     "reject",
+			wantCode: http.StatusUnauthorized,
+			wantBody: "unauthorized\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantAuth, recorder.Header().Get("X-Auth"))
+		})
+	}
+}
+
+func TestWrapMiddleware_Written(t *testing.T) {
+	testCases := []struct {
+		name string
+		mw   func(next http.Handler) http.Handler
+	}{
+		{
+			name: "pass through",
+			mw: func(next http.Handler) http.Handler {
+				return next
+			},
+		},
+		{
+			// 缓冲响应的 middleware，例如 gzip、ETag
+			name: "buffering",
+			mw: func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					bw := &bufferingWriter{ResponseWriter: w}
+					next.ServeHTTP(bw, r)
+					_, _ = w.Write(bw.buf.Bytes())
+				})
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(ServerWithMiddleware(WrapMiddleware(tc.mw)))
+			s.Get("/stream", func(ctx *Context) {
+				_, _ = ctx.Resp.Write([]byte("chunk"))
+				ctx.Resp.(http.Flusher).Flush()
+			})
+
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, "chunk", recorder.Body.String())
+			assert.Equal(t, "", recorder.Header().Get("Content-Length"))
+		})
+	}
+}
+
+// bufferingWriter 缓冲所有写入的数据
+type bufferingWriter struct {
+	http.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *bufferingWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *bufferingWriter) WriteHeader(statusCode int) {}
+
+func (w *bufferingWriter) Flush() {}
+
+func TestHTTPServer_Mount(t *testing.T) {
+	sub := NewHTTPServer()
+	sub.Get("/", func(ctx *Context) {
+		ctx.RespData = []byte("sub index")
+	})
+	sub.Get("/user/:id", func(ctx *Context) {
+		ctx.RespData = []byte("sub user " + ctx.PathParams.ByName("id"))
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("mux " + r.URL.Path))
+	})
+
+	s := NewHTTPServer()
+	s.Mount("/sub", sub)
+	s.Mount("/debug", mux)
+	s.Get("/user", func(ctx *Context) {
+		ctx.RespData = []byte("user")
+	})
+
+	testCases := []struct {
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{path: "/sub", wantCode: http.StatusOK, wantBody: "sub index"},
+		{path: "/sub/user/42", wantCode: http.StatusOK, wantBody: "sub user 42"},
+		{path: "/sub/abc", wantCode: http.StatusNotFound, wantBody: "Not Found"},
+		{path: "/debug/pprof/heap", wantCode: http.StatusOK, wantBody: "mux /pprof/heap"},
+		{path: "/user", wantCode: http.StatusOK, wantBody: "user"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package web
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bindSources 是 Bind 支持的标签，一个字段有多个标签的时候按照这个顺序取第一个有值的
+var bindSources = []string{"path", "query", "form", "header"}
+
+// defaultMultipartMemory 是解析 multipart 表单的时候最多使用的内存
+const defaultMultipartMemory = 32 << 20
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	textType     = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Bind 把请求绑定到 val 上，val 必须是结构体指针
+// 首先按照 Content-Type 选择 RegisterCodec 注册的编解码器把请求体解析到 val 上，
+// 表单请求体只会被解析，字段由 form 标签填充；
+// 然后按照字段的标签填充字段，标签的值是参数的名字：
+//   - path:"id" 路径参数
+//   - query:"page" 查询参数
+//   - form:"name" 表单参数，包括查询参数和 x-www-form-urlencoded、multipart/form-data 的请求体
+//   - header:"X-Token" 请求头
+//
+// 支持字符串、整数、浮点数、布尔值、time.Time、time.Duration、
+// 实现了 encoding.TextUnmarshaler 的类型，以及它们的指针和切片。
+// time.Time 默认按照 RFC3339 解析，可以通过 time_format 标签指定格式。
+// 没有标签的结构体字段会被递归绑定。
+// 所有字段的绑定错误会被收集到 BindErrors 中一起返回。
+// 绑定成功之后会按照 validate 标签校验，校验失败返回 ValidationErrors，见 Validate
+func (c *Context) Bind(val any) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("web: Bind 只支持非 nil 的结构体指针")
+	}
+	if err := c.bindBody(val); err != nil {
+		return err
+	}
+	var errs BindErrors
+	c.bindStruct(rv.Elem(), "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return Validate(val)
+}
+
+// bindBody 按照 Content-Type 解析请求体
+func (c *Context) bindBody(val any) error {
+	if c.Req.Body == nil || c.Req.Body == http.NoBody {
+		return nil
+	}
+	ct := c.Req.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("web: 非法的 Content-Type %s: %w", ct, err)
+	}
+	if mediaType == MIMEForm || mediaType == "multipart/form-data" {
+		if err = c.parseForm(); err != nil {
+			return fmt.Errorf("web: 解析表单失败: %w", err)
+		}
+		return nil
+	}
+	codec, ok := codecOf(mediaType)
+	if !ok {
+		return fmt.Errorf("web: 不支持的 Content-Type %s", mediaType)
+	}
+	data, err := c.Body()
+	if err != nil {
+		return fmt.Errorf("web: 读取请求体失败: %w", err)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if _, ok = codec.(jsonCodec); ok {
+		err = c.decodeJSON(data, val)
+	} else {
+		err = codec.Unmarshal(data, val)
+	}
+	if err != nil {
+		return fmt.Errorf("web: 解析 %s 请求体失败: %w", mediaType, err)
+	}
+	return nil
+}
+
+// parseForm 解析表单，multipart 表单会同时解析其中的文件
+func (c *Context) parseForm() error {
+	if c.Req.Form != nil {
+		return nil
+	}
+	if strings.HasPrefix(c.Req.Header.Get("Content-Type"), "multipart/form-data") {
+		return c.Req.ParseMultipartForm(defaultMultipartMemory)
+	}
+	return c.Req.ParseForm()
+}
+
+// sourceValues 返回 source 中名字为 key 的参数
+func (c *Context) sourceValues(source string, key string) []string {
+	switch source {
+	case "path":
+		if val, ok := c.PathParams.Get(key); ok {
+			return []string{val}
+		}
+	case "query":
+		if c.cacheQueryValues == nil {
+			c.cacheQueryValues = c.Req.URL.Query()
+		}
+		return c.cacheQueryValues[key]
+	case "form":
+		if c.parseForm() == nil {
+			return c.Req.Form[key]
+		}
+	case "header":
+		return c.Req.Header.Values(key)
+	}
+	return nil
+}
+
+// bindStruct 按照标签绑定 v 的字段，返回绑定了的字段数量
+func (c *Context) bindStruct(v reflect.Value, prefix string, errs *BindErrors) int {
+	t := v.Type()
+	cnt := 0
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := prefix + f.Name
+
+		tagged := false
+		for _, source := range bindSources {
+			key := f.Tag.Get(source)
+			if key == "" || key == "-" {
+				continue
+			}
+			tagged = true
+			vals := c.sourceValues(source, key)
+			if len(vals) == 0 {
+				continue
+			}
+			if err := setField(fv, vals, f.Tag); err != nil {
+				*errs = append(*errs, &FieldError{
+					Field:  name,
+					Source: source,
+					Key:    key,
+					Value:  strings.Join(vals, ","),
+					Err:    err,
+				})
+			}
+			cnt++
+			break
+		}
+		if tagged {
+			continue
+		}
+
+		switch {
+		case isNestedStruct(f.Type):
+			cnt += c.bindStruct(fv, name+".", errs)
+		case f.Type.Kind() == reflect.Pointer && isNestedStruct(f.Type.Elem()):
+			if !fv.IsNil() {
+				cnt += c.bindStruct(fv.Elem(), name+".", errs)
+				continue
+			}
+			// 只有绑定了字段才创建嵌套的结构体，避免覆盖请求体中的 null
+			nested := reflect.New(f.Type.Elem())
+			if n := c.bindStruct(nested.Elem(), name+".", errs); n > 0 {
+				fv.Set(nested)
+				cnt += n
+			}
+		}
+	}
+	return cnt
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(textType)
+}
+
+// setField 把 vals 转换之后写入 fv，切片会使用所有的值，其它类型只使用第一个值
+func setField(fv reflect.Value, vals []string, tag reflect.StructTag) error {
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val, tag); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, vals[0], tag)
+}
+
+func setValue(v reflect.Value, val string, tag reflect.StructTag) error {
+	switch v.Type() {
+	case timeType:
+		t, err := parseTime(val, tag.Get("time_format"))
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), val, tag); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(val))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Slice:
+		// 只有 []byte 会走到这里
+		v.SetBytes([]byte(val))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// parseTime 按照 layout 解析时间，layout 为空的时候使用 RFC3339，
+// 为 unix 的时候按照秒级时间戳解析
+func parseTime(val string, layout string) (time.Time, error) {
+	switch layout {
+	case "":
+		layout = time.RFC3339
+	case "unix":
+		sec, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(layout, val)
+}
+
+// FieldError 是一个字段的绑定错误
+type FieldError struct {
+	// Field 是字段名，嵌套结构体的字段用 . 连接，例如 Page.Size
+	Field string
+	// Source 是参数的来源：path、query、form 或者 header
+	Source string
+	// Key 是参数的名字
+	Key string
+	// Value 是参数的值，多个值用 , 连接
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("web: 字段 %s 绑定失败，%s 参数 %s 的值 %s 无法转换: %v",
+		e.Field, e.Source, e.Key, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// BindErrors 是 Bind 收集到的所有字段的绑定错误
+type BindErrors []*FieldError
+
+func (e BindErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
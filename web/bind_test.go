@@ -0,0 +1,145 @@
+package web
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindPage struct {
+	Page int  `query:"page"`
+	Size *int `query:"size"`
+}
+
+type bindReq struct {
+	ID       int64         `path:"id"`
+	Tags     []string      `query:"tag"`
+	IDs      []int         `query:"ids"`
+	Active   bool          `query:"active"`
+	Since    time.Time     `query:"since" time_format:"2006-01-02"`
+	Timeout  time.Duration `query:"timeout"`
+	Token    string        `header:"X-Token"`
+	Name     string        `json:"name" form:"name"`
+	Age      uint8         `json:"age"`
+	Page     bindPage
+	Filter   *bindPage
+	internal string `query:"internal"`
+}
+
+func TestContext_Bind(t *testing.T) {
+	size := 20
+	since, err := time.Parse("2006-01-02", "2023-01-02")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name    string
+		req     func() *http.Request
+		want    bindReq
+		wantErr string
+	}{
+		{
+			name: "json",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost,
+					"/user/123?tag=a&tag=b&ids=1&ids=2&active=true&since=2023-01-02&timeout=3s&page=2&size=20&internal=x",
+					strings.NewReader(`{"name":"tom","age":18}`))
+				req.Header.Set("Content-Type", "application/json; charset=utf-8")
+				req.Header.Set("X-Token", "secret")
+				return req
+			},
+			want: bindReq{
+				ID:      123,
+				Tags:    []string{"a", "b"},
+				IDs:     []int{1, 2},
+				Active:  true,
+				Since:   since,
+				Timeout: 3 * time.Second,
+				Token:   "secret",
+				Name:    "tom",
+				Age:     18,
+				Page:    bindPage{Page: 2, Size: &size},
+				Filter:  &bindPage{Page: 2, Size: &size},
+			},
+		},
+		{
+			name: "form",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user/1",
+					strings.NewReader(url.Values{"name": {"jerry"}}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return req
+			},
+			want: bindReq{ID: 1, Name: "jerry"},
+		},
+		{
+			name: "multipart",
+			req: func() *http.Request {
+				body := &bytes.Buffer{}
+				w := multipart.NewWriter(body)
+				require.NoError(t, w.WriteField("name", "spike"))
+				require.NoError(t, w.Close())
+				req := httptest.NewRequest(http.MethodPost, "/user/1", body)
+				req.Header.Set("Content-Type", w.FormDataContentType())
+				return req
+			},
+			want: bindReq{ID: 1, Name: "spike"},
+		},
+		{
+			name: "invalid json",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user/1", strings.NewReader(`{"name":`))
+				req.Header.Set("Content-Type", "application/json")
+				return req
+			},
+			wantErr: "web: 解析 application/json 请求体失败: unexpected EOF",
+		},
+		{
+			name: "field errors",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/user/abc?ids=1&ids=x&active=yes", nil)
+			},
+			wantErr: `web: 字段 ID 绑定失败，path 参数 id 的值 abc 无法转换: strconv.ParseInt: parsing "abc": invalid syntax; ` +
+				`web: 字段 IDs 绑定失败，query 参数 ids 的值 1,x 无法转换: strconv.ParseInt: parsing "x": invalid syntax; ` +
+				`web: 字段 Active 绑定失败，query 参数 active 的值 yes 无法转换: strconv.ParseBool: parsing "yes": invalid syntax`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer()
+			var got bindReq
+			var bindErr error
+			s.Handle([]string{http.MethodGet, http.MethodPost}, "/user/:id", func(ctx *Context) {
+				bindErr = ctx.Bind(&got)
+			})
+			s.ServeHTTP(httptest.NewRecorder(), tc.req())
+			if tc.wantErr != "" {
+				assert.EqualError(t, bindErr, tc.wantErr)
+				return
+			}
+			require.NoError(t, bindErr)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestContext_Bind_Errors(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/?page=x", nil)}
+	var page bindPage
+	err := ctx.Bind(&page)
+	var errs BindErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "Page", errs[0].Field)
+	assert.Equal(t, "query", errs[0].Source)
+	assert.Equal(t, "page", errs[0].Key)
+
+	assert.EqualError(t, ctx.Bind(page), "web: Bind 只支持非 nil 的结构体指针")
+}
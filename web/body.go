@@ -0,0 +1,152 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrBodyTooLarge 表示请求体超过了限制，HTTPServer 会响应 413
+var ErrBodyTooLarge = errors.New("web: 请求体过大")
+
+// JSONOptions 控制 BindJSON 和 Bind 解析 JSON 请求体的行为
+type JSONOptions struct {
+	// DisallowUnknownFields 为 true 的时候，请求体中出现结构体没有的字段会解析失败
+	DisallowUnknownFields bool
+	// UseNumber 为 true 的时候，数字解析到 interface{} 上是 json.Number 而不是 float64
+	UseNumber bool
+}
+
+// ServerWithBodyLimit 限制请求体的大小，单位是字节，小于等于 0 表示不限制
+// 超过限制的时候读取请求体会返回 ErrBodyTooLarge，并且响应 413。
+// 可以使用 BodyLimit middleware 为某些路由设置不同的限制
+func ServerWithBodyLimit(limit int64) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.bodyLimit = limit
+	}
+}
+
+// ServerWithJSONOptions 设置解析 JSON 请求体的默认行为，handler 里面可以通过 Context.JSONOptions 修改
+func ServerWithJSONOptions(opts JSONOptions) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.jsonOptions = opts
+	}
+}
+
+// BodyLimit 返回限制请求体大小的 middleware，覆盖 ServerWithBodyLimit 的设置，小于等于 0 表示不限制
+// 配合 Use 或者 RouteGroup 使用，例如为上传文件的路由放宽限制：
+//
+//	s.Use(http.MethodPost, "/upload", web.BodyLimit(100<<20))
+func BodyLimit(limit int64) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.SetBodyLimit(limit)
+			next(ctx)
+		}
+	}
+}
+
+// SetBodyLimit 限制请求体的大小，已经读取的部分也计算在内，小于等于 0 表示不限制
+// 请求体已经被 Body 读取并缓存之后再设置不会生效
+func (c *Context) SetBodyLimit(limit int64) {
+	c.body.limit = limit
+	if c.rawBody != nil || c.Req.Body == nil || c.Req.Body == http.NoBody || c.Req.Body == io.ReadCloser(&c.body) {
+		return
+	}
+	c.body.rc = c.Req.Body
+	c.body.contentLength = c.Req.ContentLength
+	c.Req.Body = &c.body
+}
+
+// rejectOversizedBody 在执行 handler 之前检查请求头声明的长度，
+// 超过限制的时候不执行 handler，直接响应 413。否则 handler 不读取请求体的时候会响应 200
+// 在路由的 handler 外面检查，这样 BodyLimit middleware 设置的限制也会生效
+func rejectOversizedBody(handler HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		b := &ctx.body
+		if b.limit > 0 && b.read == 0 && b.contentLength > b.limit &&
+			ctx.Req.Body == io.ReadCloser(b) {
+			b.exceeded = true
+			return
+		}
+		handler(ctx)
+	}
+}
+
+// Body 读取整个请求体并缓存起来，之后再次调用直接返回缓存
+// 每次调用之后 Req.Body 都会重新指向缓存的开头，所以签名校验之类的 middleware 读取之后，
+// handler 依旧可以读取请求体。返回的切片不能修改
+func (c *Context) Body() ([]byte, error) {
+	if c.rawBody == nil {
+		if c.Req.Body == nil || c.Req.Body == http.NoBody {
+			return nil, nil
+		}
+		data, err := io.ReadAll(c.Req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			data = []byte{}
+		}
+		c.rawBody = data
+	}
+	c.Req.Body = io.NopCloser(bytes.NewReader(c.rawBody))
+	return c.rawBody, nil
+}
+
+// decodeJSON 按照 JSONOptions 解析 JSON，只解析第一个 JSON 值
+func (c *Context) decodeJSON(data []byte, val any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if c.JSONOptions.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if c.JSONOptions.UseNumber {
+		decoder.UseNumber()
+	}
+	return decoder.Decode(val)
+}
+
+// limitedBody 限制请求体的大小，和 http.MaxBytesReader 类似，但是限制可以在读取之前修改
+type limitedBody struct {
+	rc            io.ReadCloser
+	contentLength int64
+	limit         int64
+	read          int64
+	// exceeded 为 true 表示请求体超过了限制
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.exceeded {
+		return 0, ErrBodyTooLarge
+	}
+	if b.limit <= 0 {
+		n, err := b.rc.Read(p)
+		b.read += int64(n)
+		return n, err
+	}
+	// 请求头声明的长度已经超过限制，不需要读取
+	if b.read == 0 && b.contentLength > b.limit {
+		b.exceeded = true
+		return 0, ErrBodyTooLarge
+	}
+	// 多读一个字节用来判断是否超过限制
+	if remaining := b.limit - b.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := b.rc.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		n -= int(b.read - b.limit)
+		b.read = b.limit
+		b.exceeded = true
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.rc.Close()
+}
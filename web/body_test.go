@@ -0,0 +1,168 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServer_BodyLimit(t *testing.T) {
+	s := NewHTTPServer(ServerWithBodyLimit(10))
+	var readErr error
+	read := func(ctx *Context) {
+		var data []byte
+		data, readErr = ctx.Body()
+		if readErr != nil {
+			ctx.RespStatusCode = http.StatusBadRequest
+			return
+		}
+		ctx.RespData = data
+	}
+	s.Post("/small", read)
+	s.Post("/upload", read)
+	s.Use(http.MethodPost, "/upload", BodyLimit(20))
+	s.Post("/tiny", read)
+	s.Use(http.MethodPost, "/tiny", BodyLimit(3))
+	s.Post("/ignore", func(ctx *Context) {})
+
+	testCases := []struct {
+		name     string
+		path     string
+		body     string
+		chunked  bool
+		wantCode int
+		// wantRead 表示 handler 读取请求体的时候才发现超过了限制
+		wantRead bool
+	}{
+		{name: "within limit", path: "/small", body: "0123456789", wantCode: http.StatusOK},
+		{name: "content length too large", path: "/small", body: "0123456789a", wantCode: http.StatusRequestEntityTooLarge},
+		{name: "chunked too large", path: "/small", body: "0123456789a", chunked: true, wantCode: http.StatusRequestEntityTooLarge, wantRead: true},
+		{name: "route raises limit", path: "/upload", body: "0123456789abcdef", wantCode: http.StatusOK},
+		{name: "route lowers limit", path: "/tiny", body: "0123", chunked: true, wantCode: http.StatusRequestEntityTooLarge, wantRead: true},
+		{name: "handler not reading", path: "/ignore", body: "0123456789a", wantCode: http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			readErr = nil
+			var body io.Reader = strings.NewReader(tc.body)
+			if tc.chunked {
+				// 隐藏长度，模拟 chunked 请求体
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tc.path, body)
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode == http.StatusOK {
+				require.NoError(t, readErr)
+				assert.Equal(t, tc.body, recorder.Body.String())
+				return
+			}
+			assert.Equal(t, tc.wantRead, errors.Is(readErr, ErrBodyTooLarge))
+			assert.Equal(t, "close", recorder.Header().Get("Connection"))
+		})
+	}
+}
+
+func TestHTTPServer_BodyLimit_WrapMiddleware(t *testing.T) {
+	mw := func(next http.Handler) http.Handler {
+		return next
+	}
+	s := NewHTTPServer(ServerWithBodyLimit(4), ServerWithMiddleware(WrapMiddleware(mw)))
+	s.Post("/upload", func(ctx *Context) {
+		if _, err := ctx.Body(); err != nil {
+			ctx.RespStatusCode = http.StatusBadRequest
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", io.MultiReader(strings.NewReader("0123456789")))
+	req.ContentLength = -1
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Equal(t, "close", recorder.Header().Get("Connection"))
+}
+
+func TestContext_Body(t *testing.T) {
+	s := NewHTTPServer()
+	var signed string
+	s.Use(http.MethodPost, "/user", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			data, err := ctx.Body()
+			require.NoError(t, err)
+			signed = string(data)
+			next(ctx)
+		}
+	})
+	s.Post("/user", func(ctx *Context) {
+		var u struct {
+			Name string `json:"name"`
+		}
+		require.NoError(t, ctx.BindJSON(&u))
+		// 直接读取 Req.Body 也能拿到完整的请求体
+		data, err := io.ReadAll(ctx.Req.Body)
+		require.NoError(t, err)
+		ctx.RespData = []byte(u.Name + " " + string(data))
+	})
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(`{"name":"Tom"}`)))
+	assert.Equal(t, `{"name":"Tom"}`, signed)
+	assert.Equal(t, `Tom {"name":"Tom"}`, recorder.Body.String())
+}
+
+func TestContext_JSONOptions(t *testing.T) {
+	type user struct {
+		Name  string `json:"name"`
+		Extra any    `json:"extra"`
+	}
+	testCases := []struct {
+		name    string
+		opts    JSONOptions
+		body    string
+		want    user
+		wantErr string
+	}{
+		{name: "lenient", body: `{"name":"Tom","age":18,"extra":1}`, want: user{Name: "Tom", Extra: float64(1)}},
+		{
+			name:    "disallow unknown fields",
+			opts:    JSONOptions{DisallowUnknownFields: true},
+			body:    `{"name":"Tom","age":18}`,
+			wantErr: `web: 解析 application/json 请求体失败: json: unknown field "age"`,
+		},
+		{name: "use number", opts: JSONOptions{UseNumber: true}, body: `{"name":"Tom","extra":12345678901234567890}`, want: user{Name: "Tom", Extra: json.Number("12345678901234567890")}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(ServerWithJSONOptions(tc.opts))
+			var got user
+			var bindErr error
+			s.Post("/user", func(ctx *Context) {
+				bindErr = ctx.Bind(&got)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			s.ServeHTTP(httptest.NewRecorder(), req)
+			if tc.wantErr != "" {
+				assert.EqualError(t, bindErr, tc.wantErr)
+				return
+			}
+			require.NoError(t, bindErr)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+
+	// handler 中可以单独修改
+	ctx := &Context{Req: httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"age":18}`))}
+	ctx.JSONOptions.DisallowUnknownFields = true
+	var u user
+	assert.EqualError(t, ctx.BindJSON(&u), `json: unknown field "age"`)
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// chains 记录路由的调用链是否已经组装好
+// 注册路由会让已经组装好的调用链失效，下一次匹配路由的时候重新组装
+type chains struct {
+	mu    sync.Mutex
+	built int32
+}
+
+// invalidate 让已经组装好的调用链失效
+func (c *chains) invalidate() {
+	if c != nil {
+		atomic.StoreInt32(&c.built, 0)
+	}
+}
+
+// ensureChains 保证所有路由的调用链都已经组装好
+func (r *router) ensureChains() {
+	c := r.chains
+	if c == nil || atomic.LoadInt32(&c.built) == 1 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.built == 1 {
+		return
+	}
+	r.buildChains()
+	atomic.StoreInt32(&c.built, 1)
+}
+
+// buildChains 为每一个注册了 handler 的节点计算 middleware 并组装好调用链
+// 命中同一个路由的请求，如果收集到的 middleware 和请求路径有关，
+// 例如注册了 /user/:id 又在 /user/123 上注册了 middleware，
+// 那么不会组装调用链，匹配路由的时候依旧根据请求路径收集 middleware
+func (r *router) buildChains() {
+	for _, root := range r.trees {
+		root.markMdls()
+		root.walk(func(n *node) {
+			n.chain, n.chainMdls = nil, nil
+			if n.handler == nil {
+				return
+			}
+			segs := routeSegs(n.route)
+			if r.pathDependent(root, segs) {
+				return
+			}
+			n.chainMdls = r.findMdls(root, segs)
+			n.chain = compose(n.chainMdls, routeHandler(n.handler))
+		})
+	}
+}
+
+// pathDependent 判断命中路由 segs 的请求收集到的 middleware 是否和请求路径有关
+// 路由模式中的参数段、正则段和通配符段可能被请求路径中的值替换，
+// 这些值有可能命中同一层带有 middleware 的静态节点或者其它正则节点
+func (r *router) pathDependent(root *node, segs []string) bool {
+	queue := []*node{root}
+	for _, seg := range segs {
+		dynamic := seg[0] == ':' || seg[0] == '*'
+		l := len(queue)
+		for i := 0; i < l; i++ {
+			n := queue[i]
+			if dynamic {
+				for _, child := range n.children {
+					if child.hasMdls {
+						return true
+					}
+				}
+				for _, regChild := range n.regChildren {
+					if regChild.path != seg && regChild.hasMdls {
+						return true
+					}
+				}
+			}
+			n.eachMdlsChild(seg, r.caseInsensitive, func(child *node) {
+				queue = append(queue, child)
+			})
+		}
+		queue = queue[l:]
+	}
+	// 以 * 结尾的路由能够匹配更多段，这些段可能命中 * 节点下面带有 middleware 的节点
+	if len(segs) > 0 && segs[len(segs)-1] == "*" {
+		for _, n := range queue {
+			if n.descendantsHaveMdls() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markMdls 计算 n 以及 n 的子树中是否注册了 middleware
+func (n *node) markMdls() bool {
+	has := len(n.mdls) > 0
+	for _, child := range n.children {
+		has = child.markMdls() || has
+	}
+	for _, regChild := range n.regChildren {
+		has = regChild.markMdls() || has
+	}
+	if n.paramChild != nil {
+		has = n.paramChild.markMdls() || has
+	}
+	if n.starChild != nil {
+		has = n.starChild.markMdls() || has
+	}
+	n.hasMdls = has
+	return has
+}
+
+// descendantsHaveMdls 判断 n 的子树中除了 n 本身是否注册了 middleware
+func (n *node) descendantsHaveMdls() bool {
+	for _, child := range n.children {
+		if child.hasMdls {
+			return true
+		}
+	}
+	for _, regChild := range n.regChildren {
+		if regChild.hasMdls {
+			return true
+		}
+	}
+	return (n.paramChild != nil && n.paramChild.hasMdls) ||
+		(n.starChild != nil && n.starChild.hasMdls)
+}
+
+// routeSegs 把路由切分成段，/ 没有任何段
+func routeSegs(route string) []string {
+	if route == "/" {
+		return nil
+	}
+	return strings.Split(route, "/")[1:]
+}
+
+// routeHandler 包装路由的 handler：
+// 执行之前拒绝请求头声明的长度超过限制的请求体，执行之后关闭 SSEStream
+func routeHandler(handler HandleFunc) HandleFunc {
+	return rejectOversizedBody(closeSSE(handler))
+}
+
+// compose 用 mdls 把 handler 包装起来，mdls[0] 在最外层
+func compose(mdls []Middleware, handler HandleFunc) HandleFunc {
+	for i := len(mdls) - 1; i >= 0; i-- {
+		handler = mdls[i](handler)
+	}
+	return handler
+}
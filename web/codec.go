@@ -0,0 +1,194 @@
+package web
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"google.golang.org/protobuf/proto"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// 内置编解码器对应的媒体类型
+const (
+	MIMEJSON     = "application/json"
+	MIMEXML      = "application/xml"
+	MIMETextXML  = "text/xml"
+	MIMEForm     = "application/x-www-form-urlencoded"
+	MIMEMsgPack  = "application/msgpack"
+	MIMEProtobuf = "application/x-protobuf"
+)
+
+// Codec 负责把请求体解码成 Go 的值，以及把 Go 的值编码成响应体
+type Codec interface {
+	Marshal(val any) ([]byte, error)
+	Unmarshal(data []byte, val any) error
+}
+
+var (
+	// codecs 是媒体类型到编解码器的映射
+	codecs = map[string]Codec{}
+	// codecOrder 是媒体类型的注册顺序，Accept 中的通配符按照这个顺序选择编解码器
+	codecOrder []string
+)
+
+func init() {
+	RegisterCodec(MIMEJSON, jsonCodec{})
+	RegisterCodec(MIMEXML, xmlCodec{})
+	RegisterCodec(MIMETextXML, xmlCodec{})
+	RegisterCodec(MIMEForm, formCodec{})
+	RegisterCodec(MIMEMsgPack, msgpackCodec{})
+	RegisterCodec(MIMEProtobuf, protobufCodec{})
+}
+
+// RegisterCodec 注册媒体类型的编解码器，注册之后 Bind 和 Negotiate 都会使用它
+// mediaType 不包含参数，例如 application/json。同名媒体类型会被覆盖
+// 需要在处理请求之前调用，并且不是并发安全的
+func RegisterCodec(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+	if _, ok := codecs[mediaType]; !ok {
+		codecOrder = append(codecOrder, mediaType)
+	}
+	codecs[mediaType] = codec
+}
+
+// codecOf 返回媒体类型对应的编解码器
+// 没有注册的 +json 和 +xml 结构化后缀，例如 application/problem+json，使用 JSON 和 XML 的编解码器
+func codecOf(mediaType string) (Codec, bool) {
+	mediaType = strings.ToLower(mediaType)
+	if c, ok := codecs[mediaType]; ok {
+		return c, true
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		c, ok := codecs[MIMEJSON]
+		return c, ok
+	case strings.HasSuffix(mediaType, "+xml"):
+		c, ok := codecs[MIMEXML]
+		return c, ok
+	}
+	return nil, false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(val any) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (jsonCodec) Unmarshal(data []byte, val any) error {
+	return json.Unmarshal(data, val)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(val any) ([]byte, error) {
+	return xml.Marshal(val)
+}
+
+func (xmlCodec) Unmarshal(data []byte, val any) error {
+	return xml.Unmarshal(data, val)
+}
+
+// formCodec 是 application/x-www-form-urlencoded 的编解码器
+// 支持 url.Values、map[string]string、map[string][]string，
+// 以及按照 form 标签编解码的结构体
+type formCodec struct{}
+
+func (formCodec) Marshal(val any) ([]byte, error) {
+	switch v := val.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(v).Encode()), nil
+	case map[string]string:
+		vals := make(url.Values, len(v))
+		for key, val := range v {
+			vals.Set(key, val)
+		}
+		return []byte(vals.Encode()), nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(val))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("web: 表单不支持编码 %T", val)
+	}
+	vals := url.Values{}
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		key := f.Tag.Get("form")
+		if !f.IsExported() || key == "" || key == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for j := 0; j < fv.Len(); j++ {
+				vals.Add(key, fmt.Sprint(fv.Index(j).Interface()))
+			}
+			continue
+		}
+		vals.Set(key, fmt.Sprint(reflect.Indirect(fv).Interface()))
+	}
+	return []byte(vals.Encode()), nil
+}
+
+func (formCodec) Unmarshal(data []byte, val any) error {
+	vals, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch v := val.(type) {
+	case *url.Values:
+		*v = vals
+		return nil
+	case *map[string][]string:
+		*v = vals
+		return nil
+	case *map[string]string:
+		*v = make(map[string]string, len(vals))
+		for key := range vals {
+			(*v)[key] = vals.Get(key)
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("web: 表单不支持解码到 %T", val)
+	}
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		key := f.Tag.Get("form")
+		if !f.IsExported() || key == "" || key == "-" || len(vals[key]) == 0 {
+			continue
+		}
+		if err = setField(rv.Field(i), vals[key], f.Tag); err != nil {
+			return fmt.Errorf("web: 表单参数 %s 解码失败: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// protobufCodec 只支持实现了 proto.Message 的值
+type protobufCodec struct{}
+
+var errNotProtoMessage = errors.New("web: protobuf 只支持 proto.Message")
+
+func (protobufCodec) Marshal(val any) ([]byte, error) {
+	msg, ok := val.(proto.Message)
+	if !ok {
+		return nil, errNotProtoMessage
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, val any) error {
+	msg, ok := val.(proto.Message)
+	if !ok {
+		return errNotProtoMessage
+	}
+	return proto.Unmarshal(data, msg)
+}
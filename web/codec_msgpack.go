@@ -0,0 +1,615 @@
+package web
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// msgpackCodec 是 MessagePack 的编解码器，只实现了规范中的基础类型，不支持扩展类型
+// 结构体编码成 map，键是 msgpack 标签，没有的时候使用 json 标签，再没有的时候使用字段名；
+// time.Time 编码成 RFC3339Nano 格式的字符串
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(val any) ([]byte, error) {
+	return msgpackEncode(nil, reflect.ValueOf(val))
+}
+
+func (msgpackCodec) Unmarshal(data []byte, val any) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("web: MessagePack 只能解码到非 nil 的指针")
+	}
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return errors.New("web: MessagePack 数据末尾有多余的字节")
+	}
+	return nil
+}
+
+func msgpackEncode(buf []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(buf, 0xc0), nil
+	}
+	if v.Type() == timeType {
+		return msgpackString(buf, v.Interface().(time.Time).Format(time.RFC3339Nano)), nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		return msgpackEncode(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return msgpackInt(buf, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return msgpackUint(buf, v.Uint()), nil
+	case reflect.Float32:
+		buf = append(buf, 0xca)
+		return appendUint32(buf, math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		buf = append(buf, 0xcb)
+		return appendUint64(buf, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return msgpackString(buf, v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return msgpackBytes(buf, v), nil
+		}
+		buf = msgpackHeader(buf, v.Len(), 0x90, 0xdc, 0xdd, 16)
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if buf, err = msgpackEncode(buf, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(buf, 0xc0), nil
+		}
+		buf = msgpackHeader(buf, v.Len(), 0x80, 0xde, 0xdf, 16)
+		var err error
+		iter := v.MapRange()
+		for iter.Next() {
+			if buf, err = msgpackEncode(buf, iter.Key()); err != nil {
+				return nil, err
+			}
+			if buf, err = msgpackEncode(buf, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		buf = msgpackHeader(buf, len(fields), 0x80, 0xde, 0xdf, 16)
+		var err error
+		for _, f := range fields {
+			buf = msgpackString(buf, f.name)
+			if buf, err = msgpackEncode(buf, v.Field(f.index)); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("web: MessagePack 不支持编码 %s", v.Type())
+}
+
+func msgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return msgpackUint(buf, uint64(i))
+	case i >= -32:
+		return append(buf, byte(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return appendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return appendUint32(append(buf, 0xd2), uint32(i))
+	}
+	return appendUint64(append(buf, 0xd3), uint64(i))
+}
+
+func msgpackUint(buf []byte, u uint64) []byte {
+	switch {
+	case u < 128:
+		return append(buf, byte(u))
+	case u <= math.MaxUint8:
+		return append(buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return appendUint16(append(buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		return appendUint32(append(buf, 0xce), uint32(u))
+	}
+	return appendUint64(append(buf, 0xcf), u)
+}
+
+func msgpackString(buf []byte, s string) []byte {
+	if len(s) < 32 {
+		buf = append(buf, 0xa0|byte(len(s)))
+	} else {
+		buf = msgpackLen(buf, len(s), 0xd9, 0xda, 0xdb)
+	}
+	return append(buf, s...)
+}
+
+func msgpackBytes(buf []byte, v reflect.Value) []byte {
+	buf = msgpackLen(buf, v.Len(), 0xc4, 0xc5, 0xc6)
+	for i := 0; i < v.Len(); i++ {
+		buf = append(buf, byte(v.Index(i).Uint()))
+	}
+	return buf
+}
+
+// msgpackHeader 写入数组或者 map 的长度，长度小于 fixMax 的时候使用 fix 格式
+func msgpackHeader(buf []byte, n int, fix byte, c16 byte, c32 byte, fixMax int) []byte {
+	if n < fixMax {
+		return append(buf, fix|byte(n))
+	}
+	if n <= math.MaxUint16 {
+		return appendUint16(append(buf, c16), uint16(n))
+	}
+	return appendUint32(append(buf, c32), uint32(n))
+}
+
+// msgpackLen 写入字符串或者二进制数据的长度
+func msgpackLen(buf []byte, n int, c8 byte, c16 byte, c32 byte) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(buf, c8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(buf, c16), uint16(n))
+	}
+	return appendUint32(append(buf, c32), uint32(n))
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return appendUint32(appendUint32(buf, uint32(v>>32)), uint32(v))
+}
+
+type msgpackField struct {
+	name  string
+	index int
+}
+
+func msgpackFields(t reflect.Type) []msgpackField {
+	fields := make([]msgpackField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("msgpack")
+		if name == "" {
+			name = f.Tag.Get("json")
+		}
+		name, _, _ = strings.Cut(name, ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, msgpackField{name: name, index: i})
+	}
+	return fields
+}
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+	// depth 是当前数组和 map 的嵌套层数
+	depth int
+}
+
+// maxMsgpackDepth 是允许的最大嵌套层数，和 encoding/json 一样，
+// 避免恶意的请求体用深度嵌套的数组耗尽栈空间，栈溢出是无法 recover 的
+const maxMsgpackDepth = 10000
+
+var (
+	errMsgpackShort = errors.New("web: MessagePack 数据不完整")
+	errMsgpackDepth = errors.New("web: MessagePack 嵌套层数过多")
+)
+
+// enter 进入一层数组或者 map，超过 maxMsgpackDepth 的时候返回 error
+// 返回 nil 的时候调用者需要在这一层解码完之后调用 leave
+func (d *msgpackDecoder) enter() error {
+	if d.depth >= maxMsgpackDepth {
+		return errMsgpackDepth
+	}
+	d.depth++
+	return nil
+}
+
+func (d *msgpackDecoder) leave() {
+	d.depth--
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uintN(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// decode 把下一个值解码到 v 中
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	if d.pos >= len(d.data) {
+		return errMsgpackShort
+	}
+	c := d.data[d.pos]
+	if c == 0xc0 {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		val, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		if val == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(val))
+		}
+		return nil
+	}
+
+	switch {
+	case c <= 0x7f || c >= 0xe0 || (c >= 0xcc && c <= 0xd3):
+		i, u, signed, err := d.decodeInt()
+		if err != nil {
+			return err
+		}
+		return setMsgpackNumber(v, float64(i), i, u, signed)
+	case c == 0xca || c == 0xcb:
+		f, err := d.decodeFloat()
+		if err != nil {
+			return err
+		}
+		return setMsgpackNumber(v, f, int64(f), uint64(f), f < 0)
+	case c == 0xc2 || c == 0xc3:
+		d.pos++
+		if v.Kind() != reflect.Bool {
+			return fmt.Errorf("web: MessagePack 无法把 bool 解码到 %s", v.Type())
+		}
+		v.SetBool(c == 0xc3)
+		return nil
+	case c&0xe0 == 0xa0 || c == 0xd9 || c == 0xda || c == 0xdb || c == 0xc4 || c == 0xc5 || c == 0xc6:
+		b, err := d.decodeRaw()
+		if err != nil {
+			return err
+		}
+		return setMsgpackBytes(v, b)
+	case c&0xf0 == 0x90 || c == 0xdc || c == 0xdd:
+		n, err := d.decodeLen(0x90, 0xdc)
+		if err != nil {
+			return err
+		}
+		return d.decodeArray(v, n)
+	case c&0xf0 == 0x80 || c == 0xde || c == 0xdf:
+		n, err := d.decodeLen(0x80, 0xde)
+		if err != nil {
+			return err
+		}
+		return d.decodeMap(v, n)
+	}
+	return fmt.Errorf("web: MessagePack 不支持的类型 0x%x", c)
+}
+
+func (d *msgpackDecoder) decodeInt() (int64, uint64, bool, error) {
+	c := d.data[d.pos]
+	d.pos++
+	switch {
+	case c <= 0x7f:
+		return int64(c), uint64(c), false, nil
+	case c >= 0xe0:
+		return int64(int8(c)), 0, true, nil
+	case c >= 0xcc && c <= 0xcf:
+		u, err := d.uintN(1 << (c - 0xcc))
+		return int64(u), u, false, err
+	}
+	n := 1 << (c - 0xd0)
+	u, err := d.uintN(n)
+	var i int64
+	switch n {
+	case 1:
+		i = int64(int8(u))
+	case 2:
+		i = int64(int16(u))
+	case 4:
+		i = int64(int32(u))
+	default:
+		i = int64(u)
+	}
+	return i, uint64(i), i < 0, err
+}
+
+func (d *msgpackDecoder) decodeFloat() (float64, error) {
+	c := d.data[d.pos]
+	d.pos++
+	if c == 0xca {
+		u, err := d.uintN(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	}
+	u, err := d.uintN(8)
+	return math.Float64frombits(u), err
+}
+
+// decodeRaw 解码字符串或者二进制数据
+func (d *msgpackDecoder) decodeRaw() ([]byte, error) {
+	c := d.data[d.pos]
+	d.pos++
+	var n uint64
+	var err error
+	switch {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9 || c == 0xc4:
+		n, err = d.uintN(1)
+	case c == 0xda || c == 0xc5:
+		n, err = d.uintN(2)
+	default:
+		n, err = d.uintN(4)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.next(int(n))
+}
+
+// decodeLen 解码数组或者 map 的长度
+func (d *msgpackDecoder) decodeLen(fix byte, c16 byte) (int, error) {
+	c := d.data[d.pos]
+	d.pos++
+	if c&0xf0 == fix {
+		return int(c & 0x0f), nil
+	}
+	size := 4
+	if c == c16 {
+		size = 2
+	}
+	n, err := d.uintN(size)
+	if err != nil {
+		return 0, err
+	}
+	// 每个元素至少占一个字节，长度不可能超过剩下的字节数
+	if n > uint64(len(d.data)-d.pos) {
+		return 0, errMsgpackShort
+	}
+	return int(n), nil
+}
+
+func (d *msgpackDecoder) decodeArray(v reflect.Value, n int) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), n, n))
+	case reflect.Array:
+		if v.Len() < n {
+			return fmt.Errorf("web: MessagePack 数组长度 %d 超过了 %s 的长度", n, v.Type())
+		}
+	default:
+		return fmt.Errorf("web: MessagePack 无法把数组解码到 %s", v.Type())
+	}
+	for i := 0; i < n; i++ {
+		if err := d.decode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(v reflect.Value, n int) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), n))
+		}
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			val := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(val); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, val)
+		}
+		return nil
+	case reflect.Struct:
+		fields := msgpackFields(v.Type())
+		for i := 0; i < n; i++ {
+			var key string
+			if err := d.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return err
+			}
+			idx := -1
+			for _, f := range fields {
+				if f.name == key {
+					idx = f.index
+					break
+				}
+			}
+			if idx < 0 {
+				// 忽略结构体中不存在的字段
+				if _, err := d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("web: MessagePack 无法把 map 解码到 %s", v.Type())
+}
+
+// decodeAny 解码成 Go 的基础类型：nil、bool、int64、uint64、float64、string、[]byte、[]any 和 map[string]any
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	if d.pos >= len(d.data) {
+		return nil, errMsgpackShort
+	}
+	c := d.data[d.pos]
+	switch {
+	case c == 0xc0:
+		d.pos++
+		return nil, nil
+	case c == 0xc2 || c == 0xc3:
+		d.pos++
+		return c == 0xc3, nil
+	case c <= 0x7f || c >= 0xe0 || (c >= 0xcc && c <= 0xd3):
+		i, u, signed, err := d.decodeInt()
+		if signed {
+			return i, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), err
+		}
+		return u, err
+	case c == 0xca || c == 0xcb:
+		return d.decodeFloat()
+	case c&0xe0 == 0xa0 || c == 0xd9 || c == 0xda || c == 0xdb:
+		b, err := d.decodeRaw()
+		return string(b), err
+	case c == 0xc4 || c == 0xc5 || c == 0xc6:
+		b, err := d.decodeRaw()
+		return append([]byte(nil), b...), err
+	}
+	if c&0xf0 == 0x90 || c == 0xdc || c == 0xdd {
+		n, err := d.decodeLen(0x90, 0xdc)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		arr := make([]any, n)
+		for i := range arr {
+			if arr[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return arr, nil
+	}
+	if c&0xf0 == 0x80 || c == 0xde || c == 0xdf {
+		n, err := d.decodeLen(0x80, 0xde)
+		if err != nil {
+			return nil, err
+		}
+		if err = d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		m := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			key, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			if m[fmt.Sprint(key)], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("web: MessagePack 不支持的类型 0x%x", c)
+}
+
+func setMsgpackNumber(v reflect.Value, f float64, i int64, u uint64, negative bool) error {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(i) {
+			return fmt.Errorf("web: MessagePack 数字 %d 超出了 %s 的范围", i, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if negative || v.OverflowUint(u) {
+			return fmt.Errorf("web: MessagePack 数字 %d 超出了 %s 的范围", i, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("web: MessagePack 无法把数字解码到 %s", v.Type())
+	}
+	return nil
+}
+
+func setMsgpackBytes(v reflect.Value, b []byte) error {
+	switch {
+	case v.Type() == timeType:
+		t, err := time.Parse(time.RFC3339Nano, string(b))
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case v.Kind() == reflect.String:
+		v.SetString(string(b))
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		v.SetBytes(append([]byte(nil), b...))
+	default:
+		return fmt.Errorf("web: MessagePack 无法把字符串解码到 %s", v.Type())
+	}
+	return nil
+}
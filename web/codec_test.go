@@ -0,0 +1,308 @@
+package web
+
+import (
+	"bytes"
+	"encoding/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type codecUser struct {
+	XMLName  xml.Name          `json:"-" xml:"user" msgpack:"-"`
+	ID       int64             `json:"id" xml:"id" form:"id"`
+	Name     string            `json:"name" xml:"name" form:"name"`
+	Tags     []string          `json:"tags" xml:"tag" form:"tag"`
+	Score    float64           `json:"score" xml:"score" form:"score"`
+	Admin    bool              `json:"admin" xml:"admin" form:"admin"`
+	Birthday time.Time         `json:"birthday" xml:"birthday"`
+	Attrs    map[string]string `json:"attrs" xml:"-"`
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	birthday := time.Date(2000, 1, 2, 3, 4, 5, 6, time.UTC)
+	user := codecUser{
+		ID:       -1 << 40,
+		Name:     "Tom",
+		Tags:     []string{"a", "b"},
+		Score:    9.5,
+		Admin:    true,
+		Birthday: birthday,
+		Attrs:    map[string]string{"city": "shanghai"},
+	}
+	for _, mediaType := range []string{MIMEJSON, MIMEMsgPack} {
+		t.Run(mediaType, func(t *testing.T) {
+			codec, ok := codecOf(mediaType)
+			require.True(t, ok)
+			data, err := codec.Marshal(user)
+			require.NoError(t, err)
+			var got codecUser
+			require.NoError(t, codec.Unmarshal(data, &got))
+			assert.Equal(t, user, got)
+		})
+	}
+
+	t.Run(MIMEXML, func(t *testing.T) {
+		data, err := codecs[MIMEXML].Marshal(user)
+		require.NoError(t, err)
+		var got codecUser
+		require.NoError(t, codecs[MIMEXML].Unmarshal(data, &got))
+		want := user
+		want.XMLName = xml.Name{Local: "user"}
+		want.Attrs = nil
+		assert.Equal(t, want, got)
+	})
+
+	t.Run(MIMEForm, func(t *testing.T) {
+		data, err := codecs[MIMEForm].Marshal(user)
+		require.NoError(t, err)
+		assert.Equal(t, "admin=true&id=-1099511627776&name=Tom&score=9.5&tag=a&tag=b", string(data))
+		var got codecUser
+		require.NoError(t, codecs[MIMEForm].Unmarshal(data, &got))
+		assert.Equal(t, codecUser{ID: user.ID, Name: "Tom", Tags: []string{"a", "b"}, Score: 9.5, Admin: true}, got)
+	})
+
+	t.Run(MIMEProtobuf, func(t *testing.T) {
+		data, err := codecs[MIMEProtobuf].Marshal(wrapperspb.String("Tom"))
+		require.NoError(t, err)
+		got := &wrapperspb.StringValue{}
+		require.NoError(t, codecs[MIMEProtobuf].Unmarshal(data, got))
+		assert.Equal(t, "Tom", got.GetValue())
+
+		_, err = codecs[MIMEProtobuf].Marshal(user)
+		assert.Equal(t, errNotProtoMessage, err)
+	})
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	codec := msgpackCodec{}
+	testCases := []struct {
+		name string
+		val  any
+		want []byte
+	}{
+		{name: "nil", val: nil, want: []byte{0xc0}},
+		{name: "positive fixint", val: 127, want: []byte{0x7f}},
+		{name: "negative fixint", val: -32, want: []byte{0xe0}},
+		{name: "uint16", val: uint16(256), want: []byte{0xcd, 0x01, 0x00}},
+		{name: "int8", val: -33, want: []byte{0xd0, 0xdf}},
+		{name: "float64", val: 1.5, want: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{name: "fixstr", val: "abc", want: []byte{0xa3, 'a', 'b', 'c'}},
+		{name: "bin", val: []byte{1, 2}, want: []byte{0xc4, 0x02, 0x01, 0x02}},
+		{name: "fixarray", val: []any{true, false}, want: []byte{0x92, 0xc3, 0xc2}},
+		{name: "fixmap", val: map[string]int{"a": 1}, want: []byte{0x81, 0xa1, 'a', 0x01}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := codec.Marshal(tc.val)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, data)
+		})
+	}
+
+	// 解码到 any 的时候使用基础类型
+	data, err := codec.Marshal(map[string]any{"list": []any{1, "a", nil}, "str": string(bytes.Repeat([]byte("x"), 40))})
+	require.NoError(t, err)
+	var got any
+	require.NoError(t, codec.Unmarshal(data, &got))
+	assert.Equal(t, map[string]any{"list": []any{int64(1), "a", nil}, "str": string(bytes.Repeat([]byte("x"), 40))}, got)
+
+	var small int8
+	assert.EqualError(t, codec.Unmarshal([]byte{0xcd, 0x01, 0x00}, &small), "web: MessagePack 数字 256 超出了 int8 的范围")
+	assert.EqualError(t, codec.Unmarshal([]byte{0x92, 0x01}, &got), "web: MessagePack 数据不完整")
+	assert.EqualError(t, codec.Unmarshal([]byte{0x01, 0x02}, &small), "web: MessagePack 数据末尾有多余的字节")
+
+	// 深度嵌套的数组不能耗尽栈空间
+	deep := append(bytes.Repeat([]byte{0x91}, 1<<20), 0xc0)
+	assert.Equal(t, errMsgpackDepth, codec.Unmarshal(deep, &got))
+	var nested struct {
+		Val any
+		Arr [][]any
+	}
+	assert.Equal(t, errMsgpackDepth, codec.Unmarshal(append([]byte{0x81, 0xa3, 'V', 'a', 'l'}, deep...), &nested))
+	assert.Equal(t, errMsgpackDepth, codec.Unmarshal(append([]byte{0x81, 0xa3, 'A', 'r', 'r'}, deep...), &nested))
+	// 没有超过限制的嵌套可以正常解码
+	shallow := append(bytes.Repeat([]byte{0x91}, maxMsgpackDepth), 0xc0)
+	require.NoError(t, codec.Unmarshal(shallow, &got))
+}
+
+func TestContext_Bind_Codecs(t *testing.T) {
+	type bindUser struct {
+		ID   int64  `path:"id" json:"-" xml:"-"`
+		Name string `json:"name" xml:"name"`
+		Age  int    `json:"age" xml:"age"`
+	}
+	msgpackBody, err := msgpackCodec{}.Marshal(map[string]any{"name": "Tom", "age": 18})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        []byte
+		wantErr     string
+	}{
+		{name: "xml", contentType: "application/xml", body: []byte(`<user><name>Tom</name><age>18</age></user>`)},
+		{name: "text xml", contentType: "text/xml; charset=utf-8", body: []byte(`<user><name>Tom</name><age>18</age></user>`)},
+		{name: "msgpack", contentType: MIMEMsgPack, body: msgpackBody},
+		{name: "json suffix", contentType: "application/vnd.api+json", body: []byte(`{"name":"Tom","age":18}`)},
+		{name: "unsupported", contentType: "text/plain", body: []byte("Tom"), wantErr: "web: 不支持的 Content-Type text/plain"},
+		{name: "invalid xml", contentType: "application/xml", body: []byte("<user>"), wantErr: "web: 解析 application/xml 请求体失败: XML syntax error on line 1: unexpected EOF"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer()
+			var got bindUser
+			var bindErr error
+			s.Post("/user/:id", func(ctx *Context) {
+				bindErr = ctx.Bind(&got)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/user/1", bytes.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			s.ServeHTTP(httptest.NewRecorder(), req)
+			if tc.wantErr != "" {
+				assert.EqualError(t, bindErr, tc.wantErr)
+				return
+			}
+			require.NoError(t, bindErr)
+			assert.Equal(t, bindUser{ID: 1, Name: "Tom", Age: 18}, got)
+		})
+	}
+
+	t.Run("protobuf", func(t *testing.T) {
+		body, err := proto.Marshal(wrapperspb.String("Tom"))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", MIMEProtobuf)
+		ctx := &Context{Req: req}
+		got := &wrapperspb.StringValue{}
+		require.NoError(t, ctx.Bind(got))
+		assert.Equal(t, "Tom", got.GetValue())
+	})
+}
+
+func TestContext_Negotiate(t *testing.T) {
+	type negotiateUser struct {
+		XMLName xml.Name `json:"-" xml:"user"`
+		Name    string   `json:"name" xml:"name" form:"name"`
+	}
+	val := negotiateUser{Name: "Tom"}
+	testCases := []struct {
+		name     string
+		accept   []string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{name: "no accept", wantCode: 200, wantType: "application/json; charset=utf-8", wantBody: `{"name":"Tom"}`},
+		{name: "exact", accept: []string{"application/x-www-form-urlencoded"}, wantCode: 200, wantType: MIMEForm, wantBody: "name=Tom"},
+		{name: "any", accept: []string{"*/*"}, wantCode: 200, wantType: "application/json; charset=utf-8", wantBody: `{"name":"Tom"}`},
+		{
+			name:     "q value",
+			accept:   []string{"application/json;q=0.5, application/x-www-form-urlencoded;q=0.8"},
+			wantCode: 200,
+			wantType: MIMEForm,
+			wantBody: "name=Tom",
+		},
+		{
+			name:     "more specific wins",
+			accept:   []string{"*/*", "application/json;q=0.1"},
+			wantCode: 200,
+			wantType: "application/xml; charset=utf-8",
+			wantBody: "<user><name>Tom</name></user>",
+		},
+		{
+			name:     "excluded",
+			accept:   []string{"application/*, application/json;q=0, application/xml;q=0"},
+			wantCode: 200,
+			wantType: MIMEForm,
+			wantBody: "name=Tom",
+		},
+		{name: "not acceptable", accept: []string{"text/html, image/*"}, wantCode: 406, wantBody: "Not Acceptable"},
+		{name: "all excluded", accept: []string{"*/*;q=0"}, wantCode: 406, wantBody: "Not Acceptable"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer()
+			var negErr error
+			s.Get("/user", func(ctx *Context) {
+				negErr = ctx.Negotiate(http.StatusOK, val)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			for _, accept := range tc.accept {
+				req.Header.Add("Accept", accept)
+			}
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			if tc.wantCode == http.StatusNotAcceptable {
+				assert.Equal(t, ErrNotAcceptable, negErr)
+				return
+			}
+			require.NoError(t, negErr)
+			assert.Equal(t, tc.wantType, recorder.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestContext_Negotiate_Fallback(t *testing.T) {
+	testCases := []struct {
+		name     string
+		accept   string
+		val      any
+		wantCode int
+		wantType string
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			// 浏览器的 Accept 优先 XML，但是 map 无法编码成 XML
+			name:     "browser",
+			accept:   "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			val:      map[string]string{"name": "Tom"},
+			wantCode: http.StatusOK,
+			wantType: "application/json; charset=utf-8",
+			wantBody: `{"name":"Tom"}`,
+		},
+		{
+			name:     "all failed",
+			accept:   "application/xml",
+			val:      map[string]string{"name": "Tom"},
+			wantCode: http.StatusInternalServerError,
+			wantBody: "Internal Server Error",
+			wantErr:  true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer()
+			var negErr error
+			s.Get("/user", func(ctx *Context) {
+				negErr = ctx.Negotiate(http.StatusOK, tc.val)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/user", nil)
+			req.Header.Set("Accept", tc.accept)
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantType, recorder.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantErr, negErr != nil)
+		})
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	ranges := parseAccept([]string{"text/*;q=0.5, application/json, */*;q=0.1, bad, text/html;q=0.5;level=1"})
+	assert.Equal(t, []acceptRange{
+		{typ: "application", subtype: "json", q: 1},
+		{typ: "text", subtype: "html", q: 0.5},
+		{typ: "text", subtype: "*", q: 0.5},
+		{typ: "*", subtype: "*", q: 0.1},
+	}, ranges)
+}
@@ -0,0 +1,43 @@
+package web
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	typedPattern = regexp.MustCompile(`^:(\w+)<(\w+)>$`)
+
+	// pathConstraints 是类型约束的名字到正则表达式的映射
+	pathConstraints = map[string]*regexp.Regexp{}
+)
+
+func init() {
+	RegisterPathConstraint("int", `-?[0-9]+`)
+	RegisterPathConstraint("uint", `[0-9]+`)
+	RegisterPathConstraint("alpha", `[a-zA-Z]+`)
+	RegisterPathConstraint("alnum", `[a-zA-Z0-9]+`)
+	RegisterPathConstraint("slug", `[a-z0-9]+(?:-[a-z0-9]+)*`)
+	RegisterPathConstraint("uuid", `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+}
+
+// RegisterPathConstraint 注册路径参数的类型约束
+// 注册之后就可以在路由中使用 :name<constraint>，例如 :id<int>
+// expr 会被锚定到整个路径段上。同名约束会被覆盖
+// 需要在注册路由之前调用，并且不是并发安全的
+func RegisterPathConstraint(name string, expr string) {
+	reg, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("web: 路径参数约束 %s 的正则表达式错误: %v", name, err))
+	}
+	pathConstraints[name] = reg
+}
+
+// isTypedParam 判断是不是带类型约束的路径参数，形式 :param_name<constraint>
+func isTypedParam(path string) (string, string, bool) {
+	match := typedPattern.FindStringSubmatch(path)
+	if len(match) != 3 {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
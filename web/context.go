@@ -1,16 +1,24 @@
 package web
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 )
 
+// Context 是一次请求的上下文
+// HTTPServer 通过 sync.Pool 复用 Context，handler 返回之后 Context 会被重置并交给别的请求使用，
+// 所以不能在 handler 返回之后继续持有 Context 以及其中的 PathParams，
+// 需要交给别的 goroutine 使用的时候调用 Copy
 type Context struct {
 	Req        *http.Request
 	Resp       http.ResponseWriter
-	PathParams map[string]string
+	PathParams Params
 	Route      string
 
 	RespData       []byte
@@ -21,43 +29,156 @@ type Context struct {
 	tplEngine TemplateEngine
 
 	UserValues map[string]interface{}
+
+	// JSONOptions 控制解析 JSON 请求体的行为，默认值来自 ServerWithJSONOptions
+	JSONOptions JSONOptions
+
+	// mi 是复用的路由匹配结果
+	mi matchInfo
+	// writer 是包装过的 http.ResponseWriter，ServeHTTP 会把它赋值给 Resp
+	writer responseWriter
+	// sse 是 SSE 创建的响应流，路由的 handler 返回的时候关闭，Context 重置的时候也会确保关闭
+	sse *SSEStream
+	// closing 在 HTTPServer 开始 Shutdown 的时候关闭
+	closing <-chan struct{}
+	// body 是限制了大小的请求体，SetBodyLimit 会把它赋值给 Req.Body
+	body limitedBody
+	// rawBody 是 Body 缓存的请求体
+	rawBody []byte
+}
+
+// Writer 返回包装过的 http.ResponseWriter，可以用来判断 handler 是否已经直接写出了响应
+func (c *Context) Writer() ResponseWriter {
+	return &c.writer
+}
+
+// reset 重置 Context，保留 PathParams 的空间，其余字段全部清空
+func (c *Context) reset() {
+	if c.sse != nil {
+		c.sse.Close()
+	}
+	c.mi.reset()
+	*c = Context{mi: c.mi}
+}
+
+// Copy 返回 Context 的副本，副本在 handler 返回之后依旧可以安全使用
+// 副本没有 Resp，不能用来写响应；PathParams 和 UserValues 会被复制。
+// 副本的 Req 是浅拷贝，请求体是 Body 缓存的内容，没有缓存的限制了大小的请求体在副本中为空
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Req:              c.copyReq(),
+		Route:            c.Route,
+		RespStatusCode:   c.RespStatusCode,
+		cacheQueryValues: c.cacheQueryValues,
+		tplEngine:        c.tplEngine,
+		JSONOptions:      c.JSONOptions,
+		rawBody:          c.rawBody,
+	}
+	if len(c.PathParams) > 0 {
+		cp.PathParams = append(Params(nil), c.PathParams...)
+	}
+	if c.UserValues != nil {
+		cp.UserValues = make(map[string]interface{}, len(c.UserValues))
+		for key, val := range c.UserValues {
+			cp.UserValues[key] = val
+		}
+	}
+	return cp
+}
+
+// copyReq 浅拷贝 Req，并且让副本的请求体不再引用 Context
+// 限制了大小的请求体指向 Context 中的 body 字段，Context 被复用之后就失效了
+func (c *Context) copyReq() *http.Request {
+	if c.Req == nil {
+		return nil
+	}
+	req := c.Req.WithContext(c.Req.Context())
+	switch {
+	case c.rawBody != nil:
+		req.Body = io.NopCloser(bytes.NewReader(c.rawBody))
+	case c.Req.Body == io.ReadCloser(&c.body):
+		req.Body = http.NoBody
+	}
+	return req
 }
 
+// BindJSON 把 JSON 请求体解析到 val 上
+// 请求体会被缓存，见 Body；解析的行为由 JSONOptions 控制
+// BindJSON 不会按照 validate 标签校验，需要校验的时候使用 Bind，或者之后调用 Validate
 func (c *Context) BindJSON(val interface{}) error {
 	if c.Req.Body == nil {
 		return errors.New("web: body is nil")
 	}
-	jsonDecoder := json.NewDecoder(c.Req.Body)
-	return jsonDecoder.Decode(val)
+	data, err := c.Body()
+	if err != nil {
+		return err
+	}
+	return c.decodeJSON(data, val)
 }
 
+// FormValue 返回表单参数的第一个值，表单只会被解析一次
 func (c *Context) FormValue(key string) (string, error) {
-	if err := c.Req.ParseForm(); err != nil {
+	if err := c.parseForm(); err != nil {
 		return "", err
 	}
 	return c.Req.FormValue(key), nil
 }
 
 func (c *Context) QueryValue(key string) (string, error) {
-	if c.cacheQueryValues == nil {
-		c.cacheQueryValues = c.Req.URL.Query()
-	}
-
-	vals, ok := c.cacheQueryValues[key]
-	if !ok {
-		return "", errors.New("web: key not exist")
+	vals := c.sourceValues("query", key)
+	if len(vals) == 0 {
+		return "", ErrKeyNotExist
 	}
 	return vals[0], nil
 }
 
 func (c *Context) PathValue(key string) (string, error) {
-	val, ok := c.PathParams[key]
+	val, ok := c.PathParams.Get(key)
 	if !ok {
-		return "", errors.New("web: key not exist")
+		return "", ErrKeyNotExist
 	}
 	return val, nil
 }
 
+// PathInt 返回 int 类型的路径参数，一般和 :id<int> 约束一起使用
+func (c *Context) PathInt(key string) (int, error) {
+	val, err := c.PathValue(key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("web: 路径参数 %s 转换失败: %w", key, err)
+	}
+	return res, nil
+}
+
+// PathInt64 返回 int64 类型的路径参数
+func (c *Context) PathInt64(key string) (int64, error) {
+	val, err := c.PathValue(key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("web: 路径参数 %s 转换失败: %w", key, err)
+	}
+	return res, nil
+}
+
+// PathUint64 返回 uint64 类型的路径参数，一般和 :id<uint> 约束一起使用
+func (c *Context) PathUint64(key string) (uint64, error) {
+	val, err := c.PathValue(key)
+	if err != nil {
+		return 0, err
+	}
+	res, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("web: 路径参数 %s 转换失败: %w", key, err)
+	}
+	return res, nil
+}
+
 func (c *Context) RespJSON(code int, val interface{}) error {
 	bs, err := json.Marshal(val)
 	if err != nil {
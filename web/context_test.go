@@ -0,0 +1,89 @@
+package web
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestContext_PathInt(t *testing.T) {
+	ctx := &Context{PathParams: Params{{Key: "id", Value: "123"}, {Key: "name", Value: "tom"}, {Key: "neg", Value: "-1"}}}
+
+	val, err := ctx.PathInt("id")
+	assert.NoError(t, err)
+	assert.Equal(t, 123, val)
+
+	val64, err := ctx.PathInt64("neg")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-1), val64)
+
+	_, err = ctx.PathUint64("neg")
+	assert.EqualError(t, err, `web: 路径参数 neg 转换失败: strconv.ParseUint: parsing "-1": invalid syntax`)
+
+	_, err = ctx.PathInt("name")
+	assert.EqualError(t, err, `web: 路径参数 name 转换失败: strconv.Atoi: parsing "tom": invalid syntax`)
+
+	_, err = ctx.PathInt("abc")
+	assert.Equal(t, errors.New("web: key not exist"), err)
+}
+
+func TestContext_Copy(t *testing.T) {
+	s := NewHTTPServer()
+	copied := make(chan *Context, 1)
+	s.Get("/user/:id", func(ctx *Context) {
+		ctx.UserValues = map[string]interface{}{"uid": 1}
+		copied <- ctx.Copy()
+		ctx.RespData = []byte(ctx.PathParams.ByName("id"))
+	})
+
+	for _, id := range []string{"123", "456"} {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/"+id, nil))
+		assert.Equal(t, id, recorder.Body.String())
+
+		// 原本的 Context 已经被重置并放回 pool 中，副本不受影响
+		cp := <-copied
+		assert.Equal(t, Params{{Key: "id", Value: id}}, cp.PathParams)
+		assert.Equal(t, "/user/:id", cp.Route)
+		assert.Equal(t, map[string]interface{}{"uid": 1}, cp.UserValues)
+		assert.Nil(t, cp.Resp)
+	}
+}
+
+func TestContext_Copy_Body(t *testing.T) {
+	s := NewHTTPServer(ServerWithBodyLimit(1024))
+	copied := make(chan *Context, 1)
+	s.Post("/unread", func(ctx *Context) {
+		copied <- ctx.Copy()
+	})
+	s.Post("/cached", func(ctx *Context) {
+		_, err := ctx.Body()
+		require.NoError(t, err)
+		copied <- ctx.Copy()
+	})
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{name: "unread", path: "/unread", wantBody: ""},
+		{name: "cached", path: "/cached", wantBody: "hello"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader("hello")))
+			cp := <-copied
+			// 复用原本的 Context
+			s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			data, err := io.ReadAll(cp.Req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantBody, string(data))
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 )
 
@@ -92,14 +93,19 @@ func (f *FileUploader) HandleFunc(ctx *Context) {
 // FileDownloader 直接操作了 http.ResponseWriter
 // 所以在 Middleware 里面将不能使用 RespData
 // 因为没有赋值
+// 文件路径优先从路径参数 file 中读取，例如注册为 /download/*file，
+// 其次从查询参数 file 中读取，例如 /download?file=a/b.txt
 type FileDownloader struct {
 	Dir string
 }
 
 func (f *FileDownloader) Handle() HandleFunc {
 	return func(ctx *Context) {
-		req, _ := ctx.QueryValue("file")
-		path := filepath.Join(f.Dir, filepath.Clean(req))
+		req, err := ctx.PathValue("file")
+		if err != nil {
+			req, _ = ctx.QueryValue("file")
+		}
+		path := safeJoin(f.Dir, req)
 		fn := filepath.Base(path)
 		header := ctx.Resp.Header()
 		header.Set("Content-Disposition", "attachment;filename="+fn)
@@ -127,6 +133,9 @@ type StaticResourceHandler struct {
 	maxFileSize             int
 }
 
+// NewStaticResourceHandler 创建静态资源处理器
+// 文件路径从路径参数 filename 中读取，
+// 注册为 /static/*filename 就可以访问 dir 下嵌套目录里面的文件
 func NewStaticResourceHandler(dir string) (*StaticResourceHandler, error) {
 	cache, err := lru.New(1000)
 	if err != nil {
@@ -150,12 +159,13 @@ func NewStaticResourceHandler(dir string) (*StaticResourceHandler, error) {
 
 func (h *StaticResourceHandler) Handle(ctx *Context) {
 	req, _ := ctx.PathValue("filename")
+	req = path.Clean("/" + req)
 	if item, ok := h.readFileFromData(req); ok {
 		log.Printf("从缓存中读取数据...")
 		h.writeItemAsResponse(item, ctx.Resp)
 		return
 	}
-	path := filepath.Join(h.dir, req)
+	path := safeJoin(h.dir, req)
 	f, err := os.Open(path)
 	if err != nil {
 		ctx.Resp.WriteHeader(http.StatusInternalServerError)
@@ -184,6 +194,12 @@ func (h *StaticResourceHandler) Handle(ctx *Context) {
 	h.writeItemAsResponse(item, ctx.Resp)
 }
 
+// safeJoin 拼接 dir 和请求的文件路径，
+// 请求的文件路径先按照绝对路径清理，保证结果不会跳出 dir
+func safeJoin(dir string, name string) string {
+	return filepath.Join(dir, filepath.FromSlash(path.Clean("/"+name)))
+}
+
 func (h *StaticResourceHandler) cacheFile(item *fileCacheItem) {
 	if h.cache != nil && item.fileSize < h.maxFileSize {
 		h.cache.Add(item.fileName, item)
@@ -191,9 +207,9 @@ func (h *StaticResourceHandler) cacheFile(item *fileCacheItem) {
 }
 
 func (h *StaticResourceHandler) writeItemAsResponse(item *fileCacheItem, writer http.ResponseWriter) {
-	writer.WriteHeader(http.StatusOK)
 	writer.Header().Set("Content-Type", item.contentType)
 	writer.Header().Set("Content-Length", fmt.Sprintf("%d", item.fileSize))
+	writer.WriteHeader(http.StatusOK)
 	_, _ = writer.Write(item.data)
 
 }
@@ -55,7 +55,7 @@ func TestStaticResourceHandler(t *testing.T) {
 
 	server := NewHTTPServer()
 
-	server.Get("/static/:filename", s.Handle)
+	server.Get("/static/*filename", s.Handle)
 
 	server.Start(":8081")
 }
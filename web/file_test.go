@@ -0,0 +1,64 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStaticResourceHandler_Handle(t *testing.T) {
+	h, err := NewStaticResourceHandler("testdata/static")
+	require.NoError(t, err)
+	s := NewHTTPServer()
+	s.Get("/static/*filename", h.Handle)
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/static/img/logo.png", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "image/png", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "png", recorder.Body.String())
+}
+
+func TestFileDownloader_Handle(t *testing.T) {
+	d := &FileDownloader{Dir: "testdata/download"}
+	s := NewHTTPServer()
+	s.Get("/download", d.Handle())
+	s.Get("/download/*file", d.Handle())
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "query",
+			path:     "/download?file=nested/test.txt",
+			wantCode: http.StatusOK,
+			wantBody: "nested",
+		},
+		{
+			name:     "path",
+			path:     "/download/nested/test.txt",
+			wantCode: http.StatusOK,
+			wantBody: "nested",
+		},
+		{
+			// 不能跳出 Dir 访问 testdata/static/img/logo.png
+			name:     "escape dir",
+			path:     "/download?file=../static/img/logo.png",
+			wantCode: http.StatusNotFound,
+			wantBody: "404 page not found\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
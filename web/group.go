@@ -0,0 +1,126 @@
+package web
+
+import "net/http"
+
+// RouteGroup 路由分组
+// 分组内的路由共享同一个前缀和同一组 middleware
+// 分组的 middleware 直接注册在路由树中前缀对应的节点上，
+// 所以依旧由 findMdls 负责收集，和 Use 注册的 middleware 没有区别
+type RouteGroup struct {
+	// r 是分组所在的路由，HTTPServer 默认的路由或者某个域名的路由
+	r      *router
+	parent *RouteGroup
+	prefix string
+	mdls   []Middleware
+	// methods 记录分组的 middleware 已经注册到了哪些 HTTP 方法的路由树上
+	methods map[string]bool
+}
+
+// Group 创建一个路由分组
+// prefix 的要求和路由一致：必须以 / 开头，不能以 / 结尾
+func (s *HTTPServer) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(&s.router, nil, prefix, mdls)
+}
+
+func newRouteGroup(r *router, parent *RouteGroup, prefix string, mdls []Middleware) *RouteGroup {
+	r.validatePath(prefix)
+	return &RouteGroup{
+		r:       r,
+		parent:  parent,
+		prefix:  prefix,
+		mdls:    mdls,
+		methods: map[string]bool{},
+	}
+}
+
+// Group 创建嵌套的子分组，子分组的前缀是父分组前缀加上 prefix
+func (g *RouteGroup) Group(prefix string, mdls ...Middleware) *RouteGroup {
+	return newRouteGroup(g.r, g, g.fullPath(prefix), mdls)
+}
+
+// Use 为分组追加 middleware，对已经注册和之后注册的路由都生效
+func (g *RouteGroup) Use(mdls ...Middleware) {
+	g.mdls = append(g.mdls, mdls...)
+	for method := range g.methods {
+		g.r.addRoute(method, g.prefix, nil, mdls...)
+	}
+}
+
+func (g *RouteGroup) Get(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodGet, path, handler)
+}
+
+func (g *RouteGroup) Post(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodPost, path, handler)
+}
+
+func (g *RouteGroup) Put(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodPut, path, handler)
+}
+
+func (g *RouteGroup) Patch(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodPatch, path, handler)
+}
+
+func (g *RouteGroup) Delete(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodDelete, path, handler)
+}
+
+func (g *RouteGroup) Head(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodHead, path, handler)
+}
+
+func (g *RouteGroup) Options(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodOptions, path, handler)
+}
+
+func (g *RouteGroup) Connect(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodConnect, path, handler)
+}
+
+func (g *RouteGroup) Trace(path string, handler HandleFunc) *Route {
+	return g.handle(http.MethodTrace, path, handler)
+}
+
+// Any 为所有的 HTTP 方法注册同一个 handler
+func (g *RouteGroup) Any(path string, handler HandleFunc) *Route {
+	return g.Handle(anyMethods, path, handler)
+}
+
+// Handle 为 methods 中的每一个 HTTP 方法注册同一个 handler
+func (g *RouteGroup) Handle(methods []string, path string, handler HandleFunc) *Route {
+	for _, method := range methods {
+		g.attach(method)
+	}
+	return g.r.register(methods, g.fullPath(path), handler)
+}
+
+func (g *RouteGroup) handle(method string, path string, handler HandleFunc) *Route {
+	return g.Handle([]string{method}, path, handler)
+}
+
+// attach 把分组以及所有祖先分组的 middleware 注册到 method 对应的路由树上
+// 每个分组在每棵路由树上只注册一次
+func (g *RouteGroup) attach(method string) {
+	if g.methods[method] {
+		return
+	}
+	if g.parent != nil {
+		g.parent.attach(method)
+	}
+	g.r.addRoute(method, g.prefix, nil, g.mdls...)
+	g.methods[method] = true
+}
+
+// fullPath 拼接分组前缀和 path
+// path 为 / 的时候代表分组前缀本身
+func (g *RouteGroup) fullPath(path string) string {
+	g.r.validatePath(path)
+	if path == "/" {
+		return g.prefix
+	}
+	if g.prefix == "/" {
+		return path
+	}
+	return g.prefix + path
+}
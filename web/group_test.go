@@ -0,0 +1,86 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteGroup(t *testing.T) {
+	var logs []string
+	mdl := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				logs = append(logs, name)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(ctx *Context) {
+		logs = append(logs, "handler")
+	}
+
+	s := NewHTTPServer()
+	api := s.Group("/api", mdl("api"))
+	api.Get("/", handler)
+	v1 := api.Group("/v1", mdl("v1"))
+	v1.Get("/user", handler)
+	v1.Post("/user", handler)
+	v1.Use(mdl("v1-use"))
+	s.Get("/other", handler)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		wantCode int
+		wantLogs []string
+	}{
+		{
+			name:     "group root",
+			method:   http.MethodGet,
+			path:     "/api",
+			wantCode: http.StatusOK,
+			wantLogs: []string{"api", "handler"},
+		},
+		{
+			name:     "nested get",
+			method:   http.MethodGet,
+			path:     "/api/v1/user",
+			wantCode: http.StatusOK,
+			wantLogs: []string{"api", "v1", "v1-use", "handler"},
+		},
+		{
+			name:     "nested post",
+			method:   http.MethodPost,
+			path:     "/api/v1/user",
+			wantCode: http.StatusOK,
+			wantLogs: []string{"api", "v1", "v1-use", "handler"},
+		},
+		{
+			name:     "outside group",
+			method:   http.MethodGet,
+			path:     "/other",
+			wantCode: http.StatusOK,
+			wantLogs: []string{"handler"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logs = nil
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLogs, logs)
+		})
+	}
+
+	assert.PanicsWithValue(t, "web: 路由必须以 / 开头", func() {
+		s.Group("api")
+	})
+	assert.PanicsWithValue(t, "web: 路由必须以 / 开头", func() {
+		api.Get("user", handler)
+	})
+}
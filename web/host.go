@@ -0,0 +1,83 @@
+package web
+
+import (
+	"net"
+	"strings"
+)
+
+// hostRouter 是某个域名专属的路由
+// 域名的匹配规则：
+// 1. 按照 . 切分成段，段数必须相同
+// 2. 静态段忽略大小写完全匹配
+// 3. :name 匹配任意一段，值会被放到路径参数 name 中
+// 4. * 匹配任意一段
+type hostRouter struct {
+	pattern string
+	labels  []string
+	router
+}
+
+// Host 返回域名 pattern 专属的路由分组
+// pattern 可以是 admin.example.com，也可以是 :tenant.example.com、*.example.com
+// 同一个 pattern 多次调用返回的分组共享同一个路由
+// 请求优先匹配静态域名，其次按照注册顺序匹配带参数和通配符的域名，
+// 都没有命中则使用 HTTPServer 上直接注册的路由
+func (s *HTTPServer) Host(pattern string) *RouteGroup {
+	pattern = strings.ToLower(pattern)
+	for _, h := range s.hosts {
+		if h.pattern == pattern {
+			return newRouteGroup(&h.router, nil, "/", nil)
+		}
+	}
+	h := &hostRouter{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+		router:  newRouter(),
+	}
+	h.caseInsensitive = s.caseInsensitive
+	s.hosts = append(s.hosts, h)
+	return newRouteGroup(&h.router, nil, "/", nil)
+}
+
+// routerOf 根据请求的 Host 找到对应的路由，同时返回域名中的参数
+func (s *HTTPServer) routerOf(host string) (*router, map[string]string) {
+	if len(s.hosts) == 0 {
+		return &s.router, nil
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, h := range s.hosts {
+		if h.pattern == host {
+			return &h.router, nil
+		}
+	}
+	labels := strings.Split(host, ".")
+	for _, h := range s.hosts {
+		if params, ok := h.match(labels); ok {
+			return &h.router, params
+		}
+	}
+	return &s.router, nil
+}
+
+func (h *hostRouter) match(labels []string) (map[string]string, bool) {
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, label := range h.labels {
+		switch {
+		case label == "*":
+		case strings.HasPrefix(label, ":"):
+			if params == nil {
+				params = make(map[string]string, 1)
+			}
+			params[label[1:]] = labels[i]
+		case label != labels[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPServer_Host(t *testing.T) {
+	s := NewHTTPServer()
+	s.Get("/", func(ctx *Context) {
+		ctx.RespData = []byte("default")
+	})
+
+	admin := s.Host("admin.example.com")
+	admin.Use(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.Resp.Header().Set("X-Host", "admin")
+			next(ctx)
+		}
+	})
+	admin.Get("/", func(ctx *Context) {
+		ctx.RespData = []byte("admin")
+	}).Name("admin.home")
+
+	s.Host(":tenant.example.com").Get("/users/:id", func(ctx *Context) {
+		ctx.RespData = []byte(ctx.PathParams.ByName("tenant") + "-" + ctx.PathParams.ByName("id"))
+	})
+
+	testCases := []struct {
+		name      string
+		host      string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantXHost string
+	}{
+		{
+			name:      "static host",
+			host:      "admin.example.com",
+			path:      "/",
+			wantCode:  http.StatusOK,
+			wantBody:  "admin",
+			wantXHost: "admin",
+		},
+		{
+			name:      "host with port",
+			host:      "Admin.Example.com:8080",
+			path:      "/",
+			wantCode:  http.StatusOK,
+			wantBody:  "admin",
+			wantXHost: "admin",
+		},
+		{
+			name:     "host param",
+			host:     "acme.example.com",
+			path:     "/users/42",
+			wantCode: http.StatusOK,
+			wantBody: "acme-42",
+		},
+		{
+			name:     "host param not found",
+			host:     "acme.example.com",
+			path:     "/",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "fallback",
+			host:     "www.example.org",
+			path:     "/",
+			wantCode: http.StatusOK,
+			wantBody: "default",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Host = tc.host
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantXHost, recorder.Header().Get("X-Host"))
+		})
+	}
+
+	url, err := s.URL("admin.home", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/", url)
+
+	routes := s.Routes()
+	assert.Equal(t, 3, len(routes))
+	assert.Equal(t, "", routes[0].Host)
+	assert.Equal(t, ":tenant.example.com", routes[1].Host)
+	assert.Equal(t, "admin.example.com", routes[2].Host)
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNotAcceptable 表示没有编解码器能够满足 Accept 请求头
+var ErrNotAcceptable = errors.New("web: 没有满足 Accept 的响应格式")
+
+// Negotiate 按照 Accept 请求头选择编解码器，把 val 编码成响应
+// 支持 q 值以及 type/* 和 */* 通配符，通配符按照 RegisterCodec 的注册顺序选择，所以优先使用 JSON；
+// 没有 Accept 请求头的时候使用 JSON。
+// 编码失败的时候按照优先级尝试下一个满足 Accept 的编解码器，
+// 例如浏览器的 Accept 优先 XML，但是 map 无法编码成 XML，这时候会退回 JSON。
+// 没有合适的编解码器的时候响应 406 并且返回 ErrNotAcceptable；
+// 所有合适的编解码器都编码失败的时候响应 500 并且返回第一个编码错误
+func (c *Context) Negotiate(code int, val any) error {
+	mediaTypes := negotiate(c.Req.Header.Values("Accept"))
+	if len(mediaTypes) == 0 {
+		c.RespStatusCode = http.StatusNotAcceptable
+		c.RespData = []byte(http.StatusText(http.StatusNotAcceptable))
+		return ErrNotAcceptable
+	}
+	var firstErr error
+	for _, mediaType := range mediaTypes {
+		bs, err := codecs[mediaType].Marshal(val)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if mediaType == MIMEJSON || mediaType == MIMEXML || mediaType == MIMETextXML {
+			mediaType += "; charset=utf-8"
+		}
+		c.Resp.Header().Set("Content-Type", mediaType)
+		c.RespStatusCode = code
+		c.RespData = bs
+		return nil
+	}
+	c.RespStatusCode = http.StatusInternalServerError
+	c.RespData = []byte(http.StatusText(http.StatusInternalServerError))
+	return firstErr
+}
+
+// acceptRange 是 Accept 请求头中的一项
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+// specificity 越大越具体，同样的 q 值下优先匹配更具体的项
+func (a acceptRange) specificity() int {
+	switch {
+	case a.typ == "*":
+		return 0
+	case a.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// match 判断 mediaType 是否满足这一项
+func (a acceptRange) match(mediaType string) bool {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	return (a.typ == "*" || a.typ == typ) && (a.subtype == "*" || a.subtype == subtype)
+}
+
+// negotiate 返回所有满足 Accept 的媒体类型，按照优先级从高到低排列
+// 每个媒体类型的 q 值由匹配它的最具体的项决定，例如 "*/*, application/xml;q=0" 不会选择 XML。
+// q 值大的媒体类型优先，q 值相同的时候依次比较匹配项的具体程度、在 Accept 中的位置以及注册顺序
+func negotiate(accepts []string) []string {
+	if len(accepts) == 0 {
+		return []string{MIMEJSON}
+	}
+	ranges := parseAccept(accepts)
+	var res []string
+	// idxes 是每个媒体类型匹配到的项在 ranges 中的下标
+	idxes := map[string]int{}
+	for _, mediaType := range codecOrder {
+		idx := -1
+		for i, r := range ranges {
+			if r.match(mediaType) && (idx < 0 || r.specificity() > ranges[idx].specificity()) {
+				idx = i
+			}
+		}
+		if idx < 0 || ranges[idx].q <= 0 {
+			continue
+		}
+		res = append(res, mediaType)
+		idxes[mediaType] = idx
+	}
+	// ranges 已经排好序，下标越小越优先；下标相同的保持注册顺序
+	sort.SliceStable(res, func(i, j int) bool {
+		return idxes[res[i]] < idxes[res[j]]
+	})
+	return res
+}
+
+// parseAccept 解析 Accept 请求头，按照 q 值从大到小排序，q 值相同的时候更具体的在前
+// 格式错误的项会被忽略
+func parseAccept(accepts []string) []acceptRange {
+	var ranges []acceptRange
+	for _, accept := range accepts {
+		for _, part := range strings.Split(accept, ",") {
+			mediaRange, params, _ := strings.Cut(part, ";")
+			typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mediaRange)), "/")
+			if !ok || typ == "" || subtype == "" || (typ == "*" && subtype != "*") {
+				continue
+			}
+			r := acceptRange{typ: typ, subtype: subtype, q: 1}
+			for _, param := range strings.Split(params, ";") {
+				key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(key, "q") {
+					if q, err := strconv.ParseFloat(val, 64); err == nil && q >= 0 && q <= 1 {
+						r.q = q
+					}
+				}
+			}
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity() > ranges[j].specificity()
+	})
+	return ranges
+}
@@ -0,0 +1,27 @@
+package web
+
+// Param 是一个路径参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 是命中路由之后得到的路径参数，按照在路由中出现的顺序排列
+// 路径参数一般只有几个，用切片保存比 map 更快，并且 Context 复用的时候切片的空间也能复用
+type Params []Param
+
+// Get 返回名字为 key 的路径参数，第二个返回值表示参数是否存在
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ByName 返回名字为 key 的路径参数，不存在的时候返回空字符串
+func (ps Params) ByName(key string) string {
+	val, _ := ps.Get(key)
+	return val
+}
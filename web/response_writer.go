@@ -0,0 +1,108 @@
+package web
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter 是 Context 包装过的 http.ResponseWriter
+// 记录了响应码、写入的字节数以及响应头是否已经写出
+// handler 直接往 ctx.Resp 写入响应的时候，HTTPServer 不会再写入 RespData
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	io.ReaderFrom
+	// Status 返回写出的响应码，响应头还没有写出的时候返回 0
+	Status() int
+	// Size 返回写出的响应体的字节数
+	Size() int64
+	// Written 返回响应头是否已经写出
+	Written() bool
+}
+
+var _ ResponseWriter = &responseWriter{}
+
+type responseWriter struct {
+	http.ResponseWriter
+	ctx    *Context
+	status int
+	size   int64
+}
+
+func (w *responseWriter) reset(ctx *Context, writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.ctx = ctx
+	w.status = 0
+	w.size = 0
+}
+
+// WriteHeader 写出响应头，同时把响应码同步到 ctx.RespStatusCode，
+// 这样 middleware 依旧可以通过 RespStatusCode 拿到直接写出的响应码
+// 重复调用只有第一次生效
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.Written() {
+		return
+	}
+	w.status = statusCode
+	w.ctx.RespStatusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+	return n, err
+}
+
+// ReadFrom 让 io.Copy 可以使用底层 http.ResponseWriter 的 ReadFrom，例如 sendfile
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.WriteHeader(http.StatusOK)
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.size += n
+	return n, err
+}
+
+// Flush 写出响应头以及缓冲的数据，底层不支持的时候什么也不做
+func (w *responseWriter) Flush() {
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 接管底层的连接，接管之后 HTTPServer 不会再写入响应
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("web: 底层的 http.ResponseWriter 不支持 Hijack")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		// 连接已经不归 HTTP 服务器管了，用 101 表示响应已经写出
+		w.status = http.StatusSwitchingProtocols
+		w.ctx.RespStatusCode = w.status
+	}
+	return conn, rw, err
+}
+
+// Unwrap 返回底层的 http.ResponseWriter，供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int64 {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
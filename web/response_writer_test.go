@@ -0,0 +1,95 @@
+package web
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseWriter_Stream(t *testing.T) {
+	var status int
+	var size int64
+	s := NewHTTPServer(ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			status = ctx.RespStatusCode
+			size = ctx.Writer().Size()
+		}
+	}))
+	s.Get("/stream", func(ctx *Context) {
+		ctx.Resp.Header().Set("Content-Type", "text/plain")
+		ctx.Resp.WriteHeader(http.StatusAccepted)
+		_, _ = ctx.Resp.Write([]byte("hello "))
+		ctx.Resp.(http.Flusher).Flush()
+		_, _ = io.Copy(ctx.Resp, strings.NewReader("world"))
+		// 已经直接写出了响应，RespData 会被忽略
+		ctx.RespData = []byte("ignored")
+	})
+	s.Get("/buffered", func(ctx *Context) {
+		ctx.RespStatusCode = http.StatusCreated
+		ctx.RespData = []byte("buffered")
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "hello world", recorder.Body.String())
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, int64(11), size)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/buffered", nil))
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "buffered", recorder.Body.String())
+	assert.Equal(t, "8", recorder.Header().Get("Content-Length"))
+	assert.Equal(t, http.StatusCreated, status)
+	// RespData 在所有的 middleware 执行完毕之后才写出
+	assert.Equal(t, int64(0), size)
+}
+
+func TestResponseWriter_Hijack(t *testing.T) {
+	s := NewHTTPServer()
+	s.Get("/hijack", func(ctx *Context) {
+		conn, rw, err := ctx.Resp.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 6\r\nConnection: close\r\n\r\nhijack")
+		_ = rw.Flush()
+	})
+	s.Get("/recorder", func(ctx *Context) {
+		_, _, err := ctx.Resp.(http.Hijacker).Hijack()
+		ctx.RespData = []byte(err.Error())
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{Handler: s}
+	go func() {
+		_ = srv.Serve(ln)
+	}()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /hijack HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hijack", string(body))
+
+	// httptest.ResponseRecorder 不支持 Hijack
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/recorder", nil))
+	assert.Equal(t, "web: 底层的 http.ResponseWriter 不支持 Hijack", recorder.Body.String())
+}
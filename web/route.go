@@ -2,7 +2,9 @@ package web
 
 import (
 	"fmt"
+	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -14,11 +16,19 @@ type router struct {
 	// trees 是按照 HTTP 方法来组织的
 	// 如 GET => *node
 	trees map[string]*node
+	// names 是路由名字到路由的映射，用于反向生成 URL
+	names map[string]string
+	// caseInsensitive 为 true 的时候，静态路由的匹配忽略大小写
+	caseInsensitive bool
+	// chains 为 nil 的时候不预先组装调用链
+	chains *chains
 }
 
 func newRouter() router {
 	return router{
-		trees: map[string]*node{},
+		trees:  map[string]*node{},
+		names:  map[string]string{},
+		chains: &chains{},
 	}
 }
 
@@ -29,8 +39,10 @@ func newRouter() router {
 // - 不能在同一个位置注册不同的参数路由，例如 /user/:id 和 /user/:name 冲突
 // - 不能在同一个位置同时注册通配符路由和参数路由，例如 /user/:id 和 /user/* 冲突
 // - 同名路径参数，在路由匹配的时候，值会被覆盖。例如 /user/:id/abc/:id，那么 /user/123/abc/456 最终 id = 456
+// - 命名通配符 *name 只能出现在最后一段，例如 /static/*filepath
 func (r *router) addRoute(method string, path string, handler HandleFunc, mdls ...Middleware) {
 	r.validatePath(path)
+	r.chains.invalidate()
 
 	root, ok := r.trees[method]
 	if !ok {
@@ -54,10 +66,13 @@ func (r *router) addRoute(method string, path string, handler HandleFunc, mdls .
 	}
 
 	segs := strings.Split(path, "/")
-	for _, seg := range segs[1:] {
+	for i, seg := range segs[1:] {
 		if seg == "" {
 			panic(fmt.Sprintf("web: 非法路由。不允许使用 //a/b, /a//b 之类的路由, [%s]", path))
 		}
+		if isCatchAll(seg) && i != len(segs)-2 {
+			panic(fmt.Sprintf("web: 非法路由，命名通配符只能出现在最后一段 [%s]", path))
+		}
 		root = root.childOrCreate(seg)
 	}
 
@@ -74,52 +89,132 @@ func (r *router) addRoute(method string, path string, handler HandleFunc, mdls .
 	}
 }
 
+// register 为 methods 中的每一个 HTTP 方法注册同一个 handler
+func (r *router) register(methods []string, path string, handler HandleFunc) *Route {
+	for _, method := range methods {
+		r.addRoute(method, path, handler)
+	}
+	return &Route{r: r, path: path}
+}
+
 // findRoute 查找对应的节点
 // 注意，返回的 node 内部 HandleFunc 不为 nil 才算是注册了路由
+// HEAD 请求如果没有命中注册了 handler 的节点，会尝试使用 GET 的路由
 func (r *router) findRoute(method string, path string) (*matchInfo, bool) {
+	mi := &matchInfo{}
+	return mi, r.find(method, path, mi)
+}
+
+// find 和 findRoute 一样，只是把结果写入 mi
+// HTTPServer 复用 Context 中的 matchInfo，避免每个请求都分配内存
+func (r *router) find(method string, path string, mi *matchInfo) bool {
+	ok := r.matchRoute(method, path, mi)
+	if method == http.MethodHead && (!ok || mi.n.handler == nil) {
+		if r.matchRoute(http.MethodGet, path, mi) && mi.n.handler != nil {
+			return true
+		}
+		return r.matchRoute(method, path, mi)
+	}
+	return ok
+}
+
+// allowedMethods 返回 path 上注册了 handler 的 HTTP 方法，按照字母序排列
+// 注册了 GET 的路径同样允许 HEAD
+func (r *router) allowedMethods(path string) []string {
+	var methods []string
+	var mi matchInfo
+	hasGet, hasHead := false, false
+	for method := range r.trees {
+		if !r.matchRoute(method, path, &mi) || mi.n.handler == nil {
+			continue
+		}
+		methods = append(methods, method)
+		hasGet = hasGet || method == http.MethodGet
+		hasHead = hasHead || method == http.MethodHead
+	}
+	if hasGet && !hasHead {
+		methods = append(methods, http.MethodHead)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute 在 method 对应的路由树上查找节点，结果写入 mi
+// mi 原有的内容会被清空
+func (r *router) matchRoute(method string, path string, mi *matchInfo) bool {
+	mi.reset()
 	root, ok := r.trees[method]
 	if !ok {
-		return nil, false
+		return false
 	}
 
+	r.ensureChains()
 	if path == "/" {
-		return &matchInfo{
-			n:    root,
-			mdls: root.mdls,
-		}, true
+		mi.n, mi.mdls, mi.chain = root, root.mdls, root.chain
+		return true
 	}
 
-	var params map[string]string
+	mi.segs = splitPath(mi.segs, path)
+	segs := mi.segs
+	if root.backtrack(segs, mi, r.caseInsensitive) {
+		// 回溯匹配是从最深的节点往回写入路径参数的，翻转之后和路由中出现的顺序一致
+		ps := mi.pathParams
+		for i, j := 0, len(ps)-1; i < j; i, j = i+1, j-1 {
+			ps[i], ps[j] = ps[j], ps[i]
+		}
+		if mi.n.chain != nil {
+			mi.mdls, mi.chain = mi.n.chainMdls, mi.n.chain
+		} else {
+			mi.mdls = r.findMdls(root, segs)
+		}
+		return true
+	}
+
+	// 没有任何一条路由能够处理请求，
+	// 退化为不回溯匹配，返回前缀匹配到的节点，这个节点只用于查找 middleware，
+	// 它的 handler 一定为 nil。例如 /user/ 不回溯地走到了 /user/:id，
+	// 但是回溯匹配已经拒绝了这个请求，所以不能返回
 	var anyNode *node
-	segs := strings.Split(path, "/")
-	for _, seg := range segs[1:] {
-		child, ok := root.childOf(seg)
+	for _, seg := range segs {
+		child, ok := root.childOf(seg, r.caseInsensitive)
 		if !ok {
-			if anyNode != nil {
-				return &matchInfo{
-					n:          anyNode,
-					pathParams: params,
-					mdls:       r.findMdls(r.trees[method], segs[1:]),
-				}, true
-			}
-			return nil, false
+			root = anyNode
+			break
 		}
 		if child.typ == nodeTypeAny {
 			anyNode = child
 		}
 		if child.typ == nodeTypeReg || child.typ == nodeTypeParam {
-			if params == nil {
-				params = make(map[string]string)
-			}
-			params[child.paramName] = seg
+			mi.addValue(child.paramName, seg)
 		}
 		root = child
 	}
-	return &matchInfo{
-		n:          root,
-		pathParams: params,
-		mdls:       r.findMdls(r.trees[method], segs[1:]),
-	}, true
+	if root == nil || root.handler != nil {
+		mi.reset()
+		return false
+	}
+	mi.n = root
+	mi.mdls = r.findMdls(r.trees[method], segs)
+	return true
+}
+
+// splitPath 和 strings.Split(path, "/")[1:] 的结果一样，
+// 区别在于复用 buf 的空间
+func splitPath(buf []string, path string) []string {
+	buf = buf[:0]
+	i := strings.IndexByte(path, '/')
+	if i < 0 {
+		return buf
+	}
+	path = path[i+1:]
+	for {
+		i = strings.IndexByte(path, '/')
+		if i < 0 {
+			return append(buf, path)
+		}
+		buf = append(buf, path[:i])
+		path = path[i+1:]
+	}
 }
 
 type nodeType int
@@ -138,10 +233,15 @@ const (
 // node 代表路由树的节点
 // 路由树的匹配顺序是：
 // 1. 静态完全匹配
-// 2. 正则匹配，形式 :param_name(reg_expr)
+// 2. 正则匹配，形式 :param_name(reg_expr)，或者类型约束 :param_name<constraint>
 // 3. 路径参数匹配：形式 :param_name
-// 4. 通配符匹配：*
-// 这是不回溯匹配
+// 4. 通配符匹配：* 或者命名通配符 *name
+// * 匹配一段，如果是最后一段则匹配剩下的所有段；
+// *name 匹配剩下的所有段，匹配到的值（包含 /）保存在路径参数 name 中
+// 匹配是回溯的：如果某一段按照优先级选中的子节点最终没有命中路由，
+// 会退回来尝试下一个优先级的子节点。
+// 例如注册了 /user/:id/profile 和 /user/admin/settings，
+// 那么 /user/admin/profile 会命中 /user/:id/profile
 type node struct {
 	typ nodeType
 
@@ -157,31 +257,38 @@ type node struct {
 	starChild *node
 
 	paramChild *node
-	// 正则路由和参数路由都会使用这个字段
+	// 正则路由、参数路由和命名通配符路由都会使用这个字段
 	paramName string
 
-	// 正则表达式
-	regChild *node
-	regExpr  *regexp.Regexp
+	// regChildren 正则子节点，按照注册顺序匹配
+	regChildren []*node
+	// regExpr 注册路由的时候编译好的正则表达式，只有正则节点才有
+	regExpr *regexp.Regexp
 
 	// middleware
 	mdls []Middleware
+	// hasMdls 表示以这个节点为根的子树中是否注册了 middleware
+	hasMdls bool
+	// chain 是预先用 chainMdls 包装好的 handler，
+	// 为 nil 的时候需要根据请求路径收集 middleware
+	chain     HandleFunc
+	chainMdls []Middleware
 }
 
 // child 返回子节点
 // 第一个返回值 *node 是命中的节点
 // 第二个返回值 bool 代表是否命中
-func (n *node) childOf(path string) (*node, bool) {
+func (n *node) childOf(path string, fold bool) (*node, bool) {
 	// 优先匹配静态节点
-	child, ok := n.children[path]
+	child, ok := n.staticChild(path, fold)
 	if ok {
 		return child, true
 	}
 
 	// 其次匹配正则节点
-	if n.regChild != nil {
-		if matchRegExpr(n.regChild.path, path) {
-			return n.regChild, true
+	for _, regChild := range n.regChildren {
+		if regChild.regExpr.MatchString(path) {
+			return regChild, true
 		}
 	}
 	// 再次匹配参数节点
@@ -193,14 +300,80 @@ func (n *node) childOf(path string) (*node, bool) {
 	return n.starChild, n.starChild != nil
 }
 
+// staticChild 查找静态子节点
+// fold 为 true 的时候，精确匹配失败会再忽略大小写匹配一次
+func (n *node) staticChild(path string, fold bool) (*node, bool) {
+	child, ok := n.children[path]
+	if ok || !fold {
+		return child, ok
+	}
+	for p, c := range n.children {
+		if strings.EqualFold(p, path) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// backtrack 回溯匹配 segs
+// 按照 静态 -> 正则 -> 路径参数 -> 通配符 的优先级尝试子节点，
+// 子节点匹配失败就尝试下一个优先级的子节点。
+// 只有最终命中的节点 handler 不为 nil 才算匹配成功，
+// 成功时命中的节点和路径参数会写入 mi
+// fold 为 true 的时候静态节点忽略大小写匹配
+func (n *node) backtrack(segs []string, mi *matchInfo, fold bool) bool {
+	if len(segs) == 0 {
+		if n.handler == nil {
+			return false
+		}
+		mi.n = n
+		return true
+	}
+
+	seg := segs[0]
+	if child, ok := n.staticChild(seg, fold); ok && child.backtrack(segs[1:], mi, fold) {
+		return true
+	}
+	for _, regChild := range n.regChildren {
+		if regChild.regExpr.MatchString(seg) && regChild.backtrack(segs[1:], mi, fold) {
+			mi.addValueIfAbsent(regChild.paramName, seg)
+			return true
+		}
+	}
+	// 路径参数不匹配空段，例如 /user/ 不会命中 /user/:id
+	if n.paramChild != nil && seg != "" && n.paramChild.backtrack(segs[1:], mi, fold) {
+		mi.addValueIfAbsent(n.paramChild.paramName, seg)
+		return true
+	}
+	if n.starChild != nil {
+		if n.starChild.paramName != "" {
+			// 命名通配符匹配剩下的所有段，包括其中的 /
+			if n.starChild.handler != nil {
+				mi.n = n.starChild
+				mi.addValueIfAbsent(n.starChild.paramName, strings.Join(segs, "/"))
+				return true
+			}
+		} else if n.starChild.backtrack(segs[1:], mi, fold) {
+			return true
+		}
+	}
+
+	// 通配符节点可以匹配剩下的所有段
+	if n.typ == nodeTypeAny && n.handler != nil {
+		mi.n = n
+		return true
+	}
+	return false
+}
+
 // childOrCreate 查找子节点，
 // 首先会判断 path 是不是通配符路径
 // 其次判断 path 是不是参数路径，即以 : 开头的路径
 // 最后会从 children 里面查找，
 // 如果没有找到，那么会创建一个新的节点，并且保存在 node 里面
 func (n *node) childOrCreate(path string) *node {
-	if path == "*" {
-		if n.regChild != nil {
+	if path[0] == '*' {
+		if len(n.regChildren) > 0 {
 			panic(fmt.Sprintf("web: 非法路由，已有正则路由。不允许同时注册通配符路由和正则路由 [%s]", path))
 		}
 		if n.paramChild != nil {
@@ -208,35 +381,47 @@ func (n *node) childOrCreate(path string) *node {
 		}
 		if n.starChild == nil {
 			n.starChild = &node{
-				typ:  nodeTypeAny,
-				path: path,
+				typ:       nodeTypeAny,
+				path:      path,
+				paramName: path[1:],
 			}
+		} else if n.starChild.path != path {
+			panic(fmt.Sprintf("web: 路由冲突，通配符路由冲突，已有 %s，新注册 %s", n.starChild.path, path))
 		}
 		return n.starChild
 	}
 
-	if name, isReg := isRegExpr(path); isReg {
+	if name, reg, isReg := regParam(path); isReg {
 		if n.starChild != nil {
 			panic(fmt.Sprintf("web: 非法路由，已有通配符路由。不允许同时注册通配符路由和正则路由 [%s]", path))
 		}
 		if n.paramChild != nil {
 			panic(fmt.Sprintf("web: 非法路由，已有路径参数路由。不允许同时注册正则路由和参数路由 [%s]", path))
 		}
-		if n.regChild == nil {
-			n.regChild = &node{
-				typ:       nodeTypeReg,
-				path:      path,
-				paramName: name,
+		for _, regChild := range n.regChildren {
+			if regChild.path == path {
+				return regChild
+			}
+			// 正则表达式相同，后注册的路由永远不会被匹配到
+			if regChild.regExpr.String() == reg.String() {
+				panic(fmt.Sprintf("web: 路由冲突，正则路由冲突，已有 %s，新注册 %s", regChild.path, path))
 			}
 		}
-		return n.regChild
+		regChild := &node{
+			typ:       nodeTypeReg,
+			path:      path,
+			paramName: name,
+			regExpr:   reg,
+		}
+		n.regChildren = append(n.regChildren, regChild)
+		return regChild
 	}
 
 	if string(path[0]) == ":" {
 		if n.starChild != nil {
 			panic(fmt.Sprintf("web: 非法路由，已有通配符路由。不允许同时注册通配符路由和参数路由 [%s]", path))
 		}
-		if n.regChild != nil {
+		if len(n.regChildren) > 0 {
 			panic(fmt.Sprintf("web: 非法路由，已有正则路由。不允许同时注册正则路由和参数路由 [%s]", path))
 		}
 
@@ -281,43 +466,78 @@ func (r *router) findMdls(root *node, segs []string) []Middleware {
 
 		l := len(queue)
 		for i := 0; i < l; i++ {
-			n := queue[i]
-			if n.starChild != nil {
-				mdls = append(mdls, n.starChild.mdls...)
-				queue = append(queue, n.starChild)
-			}
-			if n.paramChild != nil {
-				mdls = append(mdls, n.paramChild.mdls...)
-				queue = append(queue, n.paramChild)
-			}
-			if n.regChild != nil && matchRegExpr(n.regChild.path, seg) {
-				mdls = append(mdls, n.regChild.mdls...)
-				queue = append(queue, n.regChild)
-			}
-			if n.children != nil {
-				if child, ok := n.children[seg]; ok {
-					mdls = append(mdls, child.mdls...)
-					queue = append(queue, child)
-				}
-			}
+			queue[i].eachMdlsChild(seg, r.caseInsensitive, func(child *node) {
+				mdls = append(mdls, child.mdls...)
+				queue = append(queue, child)
+			})
 		}
 		queue = queue[l:]
 	}
 	return mdls
 }
 
+// eachMdlsChild 按照 middleware 的执行顺序遍历 seg 能够命中的子节点
+// seg 和正则节点的路由模式相同也认为是命中，Routes 会传入路由模式来计算 middleware
+func (n *node) eachMdlsChild(seg string, fold bool, fn func(child *node)) {
+	if n.starChild != nil {
+		fn(n.starChild)
+	}
+	if n.paramChild != nil {
+		fn(n.paramChild)
+	}
+	for _, regChild := range n.regChildren {
+		if regChild.path == seg || regChild.regExpr.MatchString(seg) {
+			fn(regChild)
+		}
+	}
+	if n.children != nil {
+		if child, ok := n.staticChild(seg, fold); ok {
+			fn(child)
+		}
+	}
+}
+
 type matchInfo struct {
 	n          *node
-	pathParams map[string]string
+	pathParams Params
 	mdls       []Middleware
+	// chain 是预先组装好的调用链，为 nil 的时候需要用 mdls 包装 n.handler
+	chain HandleFunc
+	// segs 是切分请求路径用的缓冲区
+	segs []string
 }
 
+// reset 清空匹配结果，保留 pathParams 和 segs 的空间用于下一次匹配
+func (m *matchInfo) reset() {
+	m.n = nil
+	m.pathParams = m.pathParams[:0]
+	m.mdls = nil
+	m.chain = nil
+}
+
+// addValue 写入路径参数，同名参数的值会被覆盖
 func (m *matchInfo) addValue(key string, value string) {
-	if m.pathParams == nil {
-		// 大多数情况，参数路径只会有一段
-		m.pathParams = map[string]string{key: value}
+	for i := range m.pathParams {
+		if m.pathParams[i].Key == key {
+			m.pathParams[i].Value = value
+			return
+		}
+	}
+	m.pathParams = append(m.pathParams, Param{Key: key, Value: value})
+}
+
+// addValueIfAbsent 回溯匹配是从最深的节点往回写入路径参数的，
+// 为了保证同名参数以后出现的为准，已经存在的值不会被覆盖
+func (m *matchInfo) addValueIfAbsent(key string, value string) {
+	if _, ok := m.pathParams.Get(key); ok {
+		return
 	}
-	m.pathParams[key] = value
+	m.pathParams = append(m.pathParams, Param{Key: key, Value: value})
+}
+
+// isCatchAll 判断是不是命名通配符，形式 *name
+func isCatchAll(path string) bool {
+	return len(path) > 1 && path[0] == '*'
 }
 
 func isRegExpr(path string) (string, bool) {
@@ -329,15 +549,32 @@ func isRegExpr(path string) (string, bool) {
 	return match[1], true
 }
 
-func matchRegExpr(pattern string, path string) bool {
-	match := regPattern.FindStringSubmatch(pattern)
-	if len(match) != 3 {
-		return false
+// regParam 解析正则路由和带类型约束的路由，返回参数名和编译好的正则表达式
+// 类型约束 :id<int> 会被当作使用约束对应正则表达式的正则路由
+func regParam(path string) (string, *regexp.Regexp, bool) {
+	if name, constraint, ok := isTypedParam(path); ok {
+		reg, ok := pathConstraints[constraint]
+		if !ok {
+			panic(fmt.Sprintf("web: 非法路由，未知的路径参数约束 [%s]", path))
+		}
+		return name, reg, true
+	}
+	if name, ok := isRegExpr(path); ok {
+		return name, compileRegExpr(path), true
 	}
+	return "", nil, false
+}
 
-	reg := regexp.MustCompile(match[2])
-	match = reg.FindStringSubmatch(path)
-	return len(match) > 0
+// compileRegExpr 在注册路由的时候编译正则表达式
+// 表达式会被锚定到整个路径段上，例如 :id([0-9]+) 不会命中 12a
+// 表达式不合法会直接 panic
+func compileRegExpr(path string) *regexp.Regexp {
+	match := regPattern.FindStringSubmatch(path)
+	reg, err := regexp.Compile("^(?:" + match[2] + ")$")
+	if err != nil {
+		panic(fmt.Sprintf("web: 非法路由，正则表达式错误 [%s]: %v", path, err))
+	}
+	return reg
 }
 
 func (r *router) validatePath(path string) {
@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"reflect"
 	"testing"
@@ -158,22 +159,26 @@ func Test_router_AddRoute(t *testing.T) {
 					"reg": {
 						path: "reg",
 						typ:  nodeTypeStatic,
-						regChild: &node{
-							path:      ":id(.*)",
-							paramName: "id",
-							typ:       nodeTypeReg,
-							handler:   mockHandler,
+						regChildren: []*node{
+							{
+								path:      ":id(.*)",
+								paramName: "id",
+								typ:       nodeTypeReg,
+								handler:   mockHandler,
+							},
 						},
 					},
 				},
-				regChild: &node{
-					path:      ":name(^.+$)",
-					paramName: "name",
-					typ:       nodeTypeReg,
-					children: map[string]*node{
-						"abc": {
-							path:    "abc",
-							handler: mockHandler,
+				regChildren: []*node{
+					{
+						path:      ":name(^.+$)",
+						paramName: "name",
+						typ:       nodeTypeReg,
+						children: map[string]*node{
+							"abc": {
+								path:    "abc",
+								handler: mockHandler,
+							},
 						},
 					},
 				},
@@ -265,6 +270,11 @@ func Test_router_AddRoute(t *testing.T) {
 		r.addRoute(http.MethodGet, "/a/b/c/:id", mockHandler)
 		r.addRoute(http.MethodGet, "/a/b/c/:name", mockHandler)
 	})
+	// 正则表达式不合法
+	r = newRouter()
+	assert.PanicsWithValue(t, "web: 非法路由，正则表达式错误 [:id([a-)]: error parsing regexp: invalid character class range: `a-)`", func() {
+		r.addRoute(http.MethodGet, "/a/:id([a-)", mockHandler)
+	})
 }
 
 func (r router) equal(y router) (string, bool) {
@@ -323,8 +333,11 @@ func (n *node) equal(y *node) (string, bool) {
 		}
 	}
 
-	if n.regChild != nil {
-		str, ok := n.regChild.equal(y.regChild)
+	if len(n.regChildren) != len(y.regChildren) {
+		return fmt.Sprintf("%s 正则子节点长度不等", n.path), false
+	}
+	for i, regChild := range n.regChildren {
+		str, ok := regChild.equal(y.regChildren[i])
 		if !ok {
 			return fmt.Sprintf("%s 路径参数节点不匹配 %s", n.path, str), false
 		}
@@ -404,7 +417,7 @@ func Test_router_findRoute(t *testing.T) {
 	}{
 		{
 			name:   "method not found",
-			method: http.MethodHead,
+			method: http.MethodOptions,
 		},
 		{
 			name:   "path not found",
@@ -511,7 +524,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    ":id",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -525,7 +538,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    "*",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -539,7 +552,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    "detail",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -553,7 +566,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    ":id(.*)",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -567,7 +580,7 @@ func Test_router_findRoute(t *testing.T) {
 					path:    ":id(.*)",
 					handler: mockHandler,
 				},
-				pathParams: map[string]string{"id": "123"},
+				pathParams: Params{{Key: "id", Value: "123"}},
 			},
 		},
 		{
@@ -576,6 +589,12 @@ func Test_router_findRoute(t *testing.T) {
 			method: http.MethodDelete,
 			path:   "/abc/home",
 		},
+		{
+			// 正则表达式匹配的是整个路径段
+			name:   "partial :id([0-9]+)",
+			method: http.MethodDelete,
+			path:   "/12a/home",
+		},
 	}
 
 	r := newRouter()
@@ -1038,3 +1057,385 @@ func Test_FindRoute_Case6(t *testing.T) {
 	assert.Equal(t, reflect.ValueOf(match.mdls[3]), reflect.ValueOf(ms3))
 	assert.Equal(t, reflect.ValueOf(match.mdls[4]), reflect.ValueOf(ms4))
 }
+
+func Test_router_findRoute_Head(t *testing.T) {
+	getHandler := HandleFunc(func(ctx *Context) {})
+	headHandler := HandleFunc(func(ctx *Context) {})
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user", getHandler)
+	r.addRoute(http.MethodGet, "/order", getHandler)
+	r.addRoute(http.MethodHead, "/order", headHandler)
+
+	// 没有 HEAD 路由，使用 GET 路由
+	mi, ok := r.findRoute(http.MethodHead, "/user")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.ValueOf(getHandler), reflect.ValueOf(mi.n.handler))
+
+	// 显式注册的 HEAD 路由优先
+	mi, ok = r.findRoute(http.MethodHead, "/order")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.ValueOf(headHandler), reflect.ValueOf(mi.n.handler))
+
+	_, ok = r.findRoute(http.MethodHead, "/abc")
+	assert.False(t, ok)
+}
+
+func Test_router_findRoute_Backtrack(t *testing.T) {
+	paramHandler := HandleFunc(func(ctx *Context) {})
+	staticHandler := HandleFunc(func(ctx *Context) {})
+	regHandler := HandleFunc(func(ctx *Context) {})
+	starHandler := HandleFunc(func(ctx *Context) {})
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user/:id/profile", paramHandler)
+	r.addRoute(http.MethodGet, "/user/admin/settings", staticHandler)
+	r.addRoute(http.MethodGet, "/order/:id(^[0-9]+$)/detail", regHandler)
+	r.addRoute(http.MethodGet, "/order/123/cancel", staticHandler)
+	r.addRoute(http.MethodGet, "/item/*/detail", starHandler)
+	r.addRoute(http.MethodGet, "/item/abc/price", staticHandler)
+	r.addRoute(http.MethodGet, "/dup/:id/a/:id", paramHandler)
+	r.addRoute(http.MethodGet, "/dup/:id/b", paramHandler)
+	r.addRoute(http.MethodGet, "/dup/x/a/y", staticHandler)
+	r.addRoute(http.MethodGet, "/member/:id", paramHandler)
+
+	testCases := []struct {
+		name        string
+		path        string
+		found       bool
+		wantHandler HandleFunc
+		wantParams  Params
+	}{
+		{
+			name:        "static first",
+			path:        "/user/admin/settings",
+			found:       true,
+			wantHandler: staticHandler,
+		},
+		{
+			name:        "static to param",
+			path:        "/user/admin/profile",
+			found:       true,
+			wantHandler: paramHandler,
+			wantParams:  Params{{Key: "id", Value: "admin"}},
+		},
+		{
+			name:        "static to reg",
+			path:        "/order/123/detail",
+			found:       true,
+			wantHandler: regHandler,
+			wantParams:  Params{{Key: "id", Value: "123"}},
+		},
+		{
+			name:        "static to star",
+			path:        "/item/abc/detail",
+			found:       true,
+			wantHandler: starHandler,
+		},
+		{
+			name:        "same param name",
+			path:        "/dup/x/a/z",
+			found:       true,
+			wantHandler: paramHandler,
+			wantParams:  Params{{Key: "id", Value: "z"}},
+		},
+		{
+			name: "no route",
+			path: "/user/admin/abc",
+		},
+		{
+			// 路径参数不匹配空段，退化的前缀匹配也不能命中
+			name: "empty param",
+			path: "/member/",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, found := r.findRoute(http.MethodGet, tc.path)
+			if !tc.found {
+				assert.True(t, !found || mi.n.handler == nil)
+				return
+			}
+			assert.True(t, found)
+			assert.Equal(t, tc.wantParams, mi.pathParams)
+			assert.Equal(t, reflect.ValueOf(tc.wantHandler), reflect.ValueOf(mi.n.handler))
+		})
+	}
+}
+
+func Test_router_CatchAll(t *testing.T) {
+	mockHandler := HandleFunc(func(ctx *Context) {})
+	staticHandler := HandleFunc(func(ctx *Context) {})
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/static/*filepath", mockHandler)
+	r.addRoute(http.MethodGet, "/static/index", staticHandler)
+	r.addRoute(http.MethodGet, "/user/:id/*rest", mockHandler)
+
+	testCases := []struct {
+		name        string
+		path        string
+		wantHandler HandleFunc
+		wantParams  Params
+	}{
+		{
+			name:        "one segment",
+			path:        "/static/a.png",
+			wantHandler: mockHandler,
+			wantParams:  Params{{Key: "filepath", Value: "a.png"}},
+		},
+		{
+			name:        "multi segments",
+			path:        "/static/img/icons/a.png",
+			wantHandler: mockHandler,
+			wantParams:  Params{{Key: "filepath", Value: "img/icons/a.png"}},
+		},
+		{
+			name:        "static first",
+			path:        "/static/index",
+			wantHandler: staticHandler,
+		},
+		{
+			name:        "backtrack from static",
+			path:        "/static/index/a.png",
+			wantHandler: mockHandler,
+			wantParams:  Params{{Key: "filepath", Value: "index/a.png"}},
+		},
+		{
+			name:        "with param",
+			path:        "/user/123/a/b",
+			wantHandler: mockHandler,
+			wantParams:  Params{{Key: "id", Value: "123"}, {Key: "rest", Value: "a/b"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, found := r.findRoute(http.MethodGet, tc.path)
+			assert.True(t, found)
+			assert.Equal(t, tc.wantParams, mi.pathParams)
+			assert.Equal(t, reflect.ValueOf(tc.wantHandler), reflect.ValueOf(mi.n.handler))
+		})
+	}
+
+	mi, found := r.findRoute(http.MethodGet, "/static")
+	assert.True(t, !found || mi.n.handler == nil)
+
+	assert.PanicsWithValue(t, "web: 非法路由，命名通配符只能出现在最后一段 [/a/*name/b]", func() {
+		r.addRoute(http.MethodGet, "/a/*name/b", mockHandler)
+	})
+	assert.PanicsWithValue(t, "web: 路由冲突，通配符路由冲突，已有 *filepath，新注册 *name", func() {
+		r.addRoute(http.MethodGet, "/static/*name", mockHandler)
+	})
+	assert.PanicsWithValue(t, "web: 非法路由，已有通配符路由。不允许同时注册通配符路由和参数路由 [:id]", func() {
+		r.addRoute(http.MethodGet, "/static/:id", mockHandler)
+	})
+}
+
+func Test_router_TypedParam(t *testing.T) {
+	mockHandler := HandleFunc(func(ctx *Context) {})
+	RegisterPathConstraint("hex", `[0-9a-f]+`)
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/user/:id<int>", mockHandler)
+	r.addRoute(http.MethodGet, "/order/:uuid<uuid>", mockHandler)
+	r.addRoute(http.MethodGet, "/tag/:slug<alpha>", mockHandler)
+	r.addRoute(http.MethodGet, "/color/:c<hex>", mockHandler)
+
+	testCases := []struct {
+		name       string
+		path       string
+		found      bool
+		wantParams Params
+	}{
+		{
+			name:       "int",
+			path:       "/user/-123",
+			found:      true,
+			wantParams: Params{{Key: "id", Value: "-123"}},
+		},
+		{
+			name: "not int",
+			path: "/user/12a",
+		},
+		{
+			name:       "uuid",
+			path:       "/order/123e4567-e89b-12d3-a456-426614174000",
+			found:      true,
+			wantParams: Params{{Key: "uuid", Value: "123e4567-e89b-12d3-a456-426614174000"}},
+		},
+		{
+			name: "not uuid",
+			path: "/order/123e4567",
+		},
+		{
+			name:       "alpha",
+			path:       "/tag/golang",
+			found:      true,
+			wantParams: Params{{Key: "slug", Value: "golang"}},
+		},
+		{
+			name: "not alpha",
+			path: "/tag/go1",
+		},
+		{
+			name:       "custom",
+			path:       "/color/ff00aa",
+			found:      true,
+			wantParams: Params{{Key: "c", Value: "ff00aa"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, found := r.findRoute(http.MethodGet, tc.path)
+			if !tc.found {
+				assert.True(t, !found || mi.n.handler == nil)
+				return
+			}
+			assert.True(t, found)
+			assert.Equal(t, tc.wantParams, mi.pathParams)
+			assert.Equal(t, nodeType(nodeTypeReg), mi.n.typ)
+		})
+	}
+
+	assert.PanicsWithValue(t, "web: 非法路由，未知的路径参数约束 [:id<abc>]", func() {
+		r.addRoute(http.MethodGet, "/a/:id<abc>", mockHandler)
+	})
+}
+
+func Test_router_SiblingRegExpr(t *testing.T) {
+	idHandler := HandleFunc(func(ctx *Context) {})
+	codeHandler := HandleFunc(func(ctx *Context) {})
+	ms := Middleware(func(next HandleFunc) HandleFunc { return next })
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/item/:id(\\d+)", idHandler, ms)
+	r.addRoute(http.MethodGet, "/item/:code([A-Z]{3})", codeHandler)
+	r.addRoute(http.MethodGet, "/item/:id(\\d+)/detail", idHandler)
+
+	mi, ok := r.findRoute(http.MethodGet, "/item/123")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.ValueOf(idHandler), reflect.ValueOf(mi.n.handler))
+	assert.Equal(t, Params{{Key: "id", Value: "123"}}, mi.pathParams)
+	assert.Len(t, mi.mdls, 1)
+
+	mi, ok = r.findRoute(http.MethodGet, "/item/ABC")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.ValueOf(codeHandler), reflect.ValueOf(mi.n.handler))
+	assert.Equal(t, Params{{Key: "code", Value: "ABC"}}, mi.pathParams)
+	assert.Len(t, mi.mdls, 0)
+
+	mi, ok = r.findRoute(http.MethodGet, "/item/123/detail")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.ValueOf(idHandler), reflect.ValueOf(mi.n.handler))
+
+	mi, ok = r.findRoute(http.MethodGet, "/item/abc")
+	assert.True(t, !ok || mi.n.handler == nil)
+
+	assert.PanicsWithValue(t, "web: 路由冲突，正则路由冲突，已有 :id(\\d+)，新注册 :num(\\d+)", func() {
+		r.addRoute(http.MethodGet, "/item/:num(\\d+)", idHandler)
+	})
+	assert.PanicsWithValue(t, "web: 路由冲突[/item/:id(\\d+)]", func() {
+		r.addRoute(http.MethodGet, "/item/:id(\\d+)", idHandler)
+	})
+}
+
+func Test_router_Chain(t *testing.T) {
+	var seq []string
+	mdl := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				seq = append(seq, name)
+				next(ctx)
+			}
+		}
+	}
+	handler := HandleFunc(func(ctx *Context) {
+		seq = append(seq, "handler")
+	})
+
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/", nil, mdl("root"))
+	r.addRoute(http.MethodGet, "/user", handler, mdl("user"))
+	r.addRoute(http.MethodGet, "/user/:id", handler, mdl("id"))
+	r.addRoute(http.MethodGet, "/order/:id", handler)
+
+	mi, ok := r.findRoute(http.MethodGet, "/user/123")
+	require.True(t, ok)
+	require.NotNil(t, mi.chain)
+	mi.chain(&Context{})
+	assert.Equal(t, []string{"root", "user", "id", "handler"}, seq)
+
+	// 新注册的 middleware 只对 /user/123 生效，/user/:id 的调用链和请求路径有关
+	r.addRoute(http.MethodGet, "/user/123", nil, mdl("123"))
+	mi, ok = r.findRoute(http.MethodGet, "/user/123")
+	require.True(t, ok)
+	assert.Nil(t, mi.chain)
+	assert.Len(t, mi.mdls, 4)
+	mi, ok = r.findRoute(http.MethodGet, "/user/456")
+	require.True(t, ok)
+	assert.Nil(t, mi.chain)
+	assert.Len(t, mi.mdls, 3)
+
+	// 其它路由不受影响
+	mi, ok = r.findRoute(http.MethodGet, "/order/123")
+	require.True(t, ok)
+	require.NotNil(t, mi.chain)
+	seq = nil
+	mi.chain(&Context{})
+	assert.Equal(t, []string{"root", "handler"}, seq)
+}
+
+func benchmarkRouter() *router {
+	mdl := Middleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	})
+	handler := func(ctx *Context) {}
+	r := newRouter()
+	r.addRoute(http.MethodGet, "/", nil, mdl)
+	r.addRoute(http.MethodGet, "/api", nil, mdl, mdl)
+	for _, path := range []string{
+		"/api/user", "/api/user/:id", "/api/user/:id/profile",
+		"/api/order", "/api/order/:id(\\d+)", "/api/order/:id(\\d+)/items",
+		"/api/product/:sku<slug>", "/static/*filepath",
+	} {
+		r.addRoute(http.MethodGet, path, handler, mdl)
+	}
+	return &r
+}
+
+func Benchmark_router_findRoute(b *testing.B) {
+	r := benchmarkRouter()
+	paths := []string{"/api/user/123/profile", "/api/order/42/items", "/static/css/app.css"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = r.findRoute(http.MethodGet, paths[i%len(paths)])
+	}
+}
+
+func Benchmark_router_serve(b *testing.B) {
+	r := benchmarkRouter()
+	ctx := &Context{}
+	b.Run("chain", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			mi, _ := r.findRoute(http.MethodGet, "/api/user/123/profile")
+			mi.chain(ctx)
+		}
+	})
+	b.Run("findMdls", func(b *testing.B) {
+		// 每次请求都收集并组装 middleware
+		b.ReportAllocs()
+		root := r.trees[http.MethodGet]
+		segs := []string{"api", "user", "123", "profile"}
+		for i := 0; i < b.N; i++ {
+			mi, _ := r.findRoute(http.MethodGet, "/api/user/123/profile")
+			compose(r.findMdls(root, segs), mi.n.handler)(ctx)
+		}
+	})
+}
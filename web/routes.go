@@ -0,0 +1,135 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo 描述一条注册好的路由
+type RouteInfo struct {
+	// Host 是 Host 注册的域名，直接注册在 HTTPServer 上的路由为空
+	Host   string `json:"host,omitempty"`
+	Method string `json:"method"`
+	Route  string `json:"route"`
+	// Handler 是 handler 的函数名
+	Handler string `json:"handler"`
+	// Middlewares 是命中该路由时会执行的 middleware 的函数名，按照执行顺序排列
+	// 包含 ServerWithMiddleware 注册的全局 middleware
+	// 只有对所有命中该路由的请求都生效的 middleware 才会被列出，
+	// 例如路由 /user/:id 不会列出 Use 在 /user/123 上的 middleware
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes 返回所有注册了 handler 的路由，按照域名、路由和 HTTP 方法排序
+func (s *HTTPServer) Routes() []RouteInfo {
+	res := s.router.routes("", s.mdls)
+	for _, h := range s.hosts {
+		res = append(res, h.routes(h.pattern, s.mdls)...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Host != res[j].Host {
+			return res[i].Host < res[j].Host
+		}
+		if res[i].Route != res[j].Route {
+			return res[i].Route < res[j].Route
+		}
+		return res[i].Method < res[j].Method
+	})
+	return res
+}
+
+func (r *router) routes(host string, globalMdls []Middleware) []RouteInfo {
+	var res []RouteInfo
+	for method, root := range r.trees {
+		root.walk(func(n *node) {
+			if n.handler == nil {
+				return
+			}
+			segs := routeSegs(n.route)
+			mdls := append(append([]Middleware{}, globalMdls...), r.findMdls(root, segs)...)
+			names := make([]string, 0, len(mdls))
+			for _, mdl := range mdls {
+				names = append(names, funcName(mdl))
+			}
+			res = append(res, RouteInfo{
+				Host:        host,
+				Method:      method,
+				Route:       n.route,
+				Handler:     funcName(n.handler),
+				Middlewares: names,
+			})
+		})
+	}
+	return res
+}
+
+// PrintRoutes 以表格的形式输出路由
+// 注册了域名路由的时候，第一列是域名
+func (s *HTTPServer) PrintRoutes(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	withHost := len(s.hosts) > 0
+	if withHost {
+		_, _ = fmt.Fprint(tw, "HOST\t")
+	}
+	_, _ = fmt.Fprintln(tw, "METHOD\tROUTE\tHANDLER\tMIDDLEWARES")
+	for _, info := range s.Routes() {
+		if withHost {
+			_, _ = fmt.Fprintf(tw, "%s\t", info.Host)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Method, info.Route,
+			info.Handler, strings.Join(info.Middlewares, " -> "))
+	}
+	return tw.Flush()
+}
+
+// RoutesHandler 以 JSON 的形式返回路由，可以注册为调试接口
+// 例如 s.Get("/debug/routes", s.RoutesHandler())
+func (s *HTTPServer) RoutesHandler() HandleFunc {
+	return func(ctx *Context) {
+		if err := ctx.RespJSON(http.StatusOK, s.Routes()); err != nil {
+			ctx.RespStatusCode = http.StatusInternalServerError
+			ctx.RespData = []byte(err.Error())
+		}
+	}
+}
+
+// ServerWithRoutesPrinter 在服务器启动的时候把路由表输出到 w
+func ServerWithRoutesPrinter(w io.Writer) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.OnStart(func(ctx context.Context) error {
+			return server.PrintRoutes(w)
+		})
+	}
+}
+
+// walk 深度优先遍历节点
+func (n *node) walk(fn func(n *node)) {
+	fn(n)
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	for _, regChild := range n.regChildren {
+		regChild.walk(fn)
+	}
+	if n.paramChild != nil {
+		n.paramChild.walk(fn)
+	}
+	if n.starChild != nil {
+		n.starChild.walk(fn)
+	}
+}
+
+func funcName(fn any) string {
+	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
+	if f == nil {
+		return "unknown"
+	}
+	return f.Name()
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func routesTestHandler(ctx *Context) {}
+
+func routesTestMdl(next HandleFunc) HandleFunc { return next }
+
+func TestHTTPServer_Routes(t *testing.T) {
+	s := NewHTTPServer(ServerWithMiddleware(routesTestMdl))
+	s.Get("/", routesTestHandler)
+	s.Get("/user/:id(^[0-9]+$)", routesTestHandler)
+	s.Use(http.MethodGet, "/user/:id(^[0-9]+$)", routesTestMdl)
+	s.Group("/api", routesTestMdl).Post("/order", routesTestHandler)
+	// 只注册了 middleware 的节点不是路由
+	s.Use(http.MethodGet, "/abc", routesTestMdl)
+
+	handler := "leason-toy-web/web.routesTestHandler"
+	mdl := "leason-toy-web/web.routesTestMdl"
+	want := []RouteInfo{
+		{Method: http.MethodGet, Route: "/", Handler: handler, Middlewares: []string{mdl}},
+		{Method: http.MethodPost, Route: "/api/order", Handler: handler, Middlewares: []string{mdl, mdl}},
+		{Method: http.MethodGet, Route: "/user/:id(^[0-9]+$)", Handler: handler, Middlewares: []string{mdl, mdl}},
+	}
+	assert.Equal(t, want, s.Routes())
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, s.PrintRoutes(buf))
+	assert.Equal(t, `METHOD  ROUTE                HANDLER                               MIDDLEWARES
+GET     /                    leason-toy-web/web.routesTestHandler  leason-toy-web/web.routesTestMdl
+POST    /api/order           leason-toy-web/web.routesTestHandler  leason-toy-web/web.routesTestMdl -> leason-toy-web/web.routesTestMdl
+GET     /user/:id(^[0-9]+$)  leason-toy-web/web.routesTestHandler  leason-toy-web/web.routesTestMdl -> leason-toy-web/web.routesTestMdl
+`, buf.String())
+
+	s.Get("/debug/routes", s.RoutesHandler())
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/routes", nil))
+	var got []RouteInfo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &got))
+	assert.Len(t, got, 4)
+}
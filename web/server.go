@@ -1,9 +1,19 @@
 package web
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
 	"net/http"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type HandleFunc func(ctx *Context)
@@ -15,6 +25,18 @@ type Server interface {
 	// 或者 "localhost:8082"
 	Start(addr string) error
 
+	// StartTLS 以 HTTPS 的形式启动服务器，同时支持 HTTP/2
+	// certFile 和 keyFile 是证书和私钥文件的路径
+	StartTLS(addr string, certFile string, keyFile string) error
+
+	// Serve 在调用者提供的 listener 上处理请求
+	// 例如 unix socket，或者 systemd socket activation 传入的 listener
+	Serve(ln net.Listener) error
+
+	// Shutdown 优雅退出
+	// 会等待正在处理的请求结束，ctx 控制最长的等待时间
+	Shutdown(ctx context.Context) error
+
 	// addRoute 注册一个路由
 	// method 是 HTTP 方法
 	addRoute(method string, path string, handler HandleFunc, mdls ...Middleware)
@@ -29,18 +51,94 @@ type HTTPServer struct {
 	router
 	mdls      []Middleware
 	tplEngine TemplateEngine
+	// handler 是创建 HTTPServer 的时候用全局 middleware 组装好的调用链
+	handler HandleFunc
+	// pool 复用 Context
+	pool sync.Pool
+
+	// srv 是真正监听端口、处理连接的 http.Server
+	srv *http.Server
+	// shutdownTimeout 优雅退出时等待请求处理完毕的最长时间
+	shutdownTimeout time.Duration
+	// enableH2C 允许不经过 TLS 的 HTTP/2
+	enableH2C bool
+
+	// notFound 没有找到路由时执行
+	notFound HandleFunc
+	// methodNotAllowed 路径存在，但是没有注册请求的 HTTP 方法时执行
+	methodNotAllowed HandleFunc
+	// autoOptions 为 true 的时候，没有注册 OPTIONS 路由的路径会自动响应 OPTIONS 请求
+	autoOptions bool
+	// cleanPath 为 true 的时候，匹配路由之前会清理请求路径中的 .. 和 //
+	cleanPath bool
+	// hosts 是按照域名划分的路由，没有命中任何域名的请求使用默认的 router
+	hosts []*hostRouter
+
+	// redirectTrailingSlash 为 true 的时候，
+	// 如果请求路径没有命中路由，但是加上或者去掉结尾的 / 之后能够命中，那么重定向过去
+	redirectTrailingSlash bool
+
+	// bodyLimit 是请求体的大小限制，小于等于 0 表示不限制
+	bodyLimit int64
+	// jsonOptions 是解析 JSON 请求体的默认行为
+	jsonOptions JSONOptions
+
+	// closing 在 Shutdown 开始的时候关闭，SSE 之类的长连接据此结束，
+	// 否则 Shutdown 要一直等到超时
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	onStart        []Hook
+	beforeShutdown []Hook
+	afterShutdown  []Hook
 }
 
+// Hook 是服务器生命周期中的回调
+// 例如在退出之前刷新 session 存储，停止 Prometheus 上报
+type Hook func(ctx context.Context) error
+
 type HTTPServerOption func(server *HTTPServer)
 
 func NewHTTPServer(opts ...HTTPServerOption) *HTTPServer {
 	s := &HTTPServer{
-		router: newRouter(),
+		router:           newRouter(),
+		shutdownTimeout:  30 * time.Second,
+		notFound:         defaultNotFound,
+		methodNotAllowed: defaultMethodNotAllowed,
+	}
+	s.srv = &http.Server{
+		Handler: s,
+		// 默认设置读取请求头的超时，避免 slowloris 攻击
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       120 * time.Second,
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+
+	s.handler = s.buildHandler()
+	s.closing = make(chan struct{})
+	s.srv.RegisterOnShutdown(func() {
+		s.closeOnce.Do(func() {
+			close(s.closing)
+		})
+	})
+	s.pool.New = func() any {
+		return &Context{}
+	}
+
+	if engine, ok := s.tplEngine.(TemplateFuncsSetter); ok {
+		engine.Funcs(map[string]any{
+			URLFuncName: s.urlFunc,
+		})
+	}
+
+	if s.enableH2C {
+		s.srv.Handler = h2c.NewHandler(s, &http2.Server{
+			IdleTimeout: s.srv.IdleTimeout,
+		})
+	}
 	return s
 }
 
@@ -56,19 +154,132 @@ func ServerWithTemplateEngine(tplEngin TemplateEngine) HTTPServerOption {
 	}
 }
 
-// ServeHTTP HTTPServer 处理请求的入口
-func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	ctx := &Context{
-		Req:       request,
-		Resp:      writer,
-		tplEngine: s.tplEngine,
+// ServerWithShutdownTimeout 设置优雅退出时等待请求处理完毕的最长时间
+// 小于等于 0 则只受 Shutdown 传入的 ctx 控制
+func ServerWithShutdownTimeout(timeout time.Duration) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.shutdownTimeout = timeout
 	}
+}
 
-	root := s.serve
-	for i := len(s.mdls) - 1; i >= 0; i-- {
-		root = s.mdls[i](root)
+// Timeouts 对应 http.Server 上的各种超时
+// 零值表示沿用默认值，负数表示不超时
+type Timeouts struct {
+	Read time.Duration
+	// ReadHeader 为零值并且设置了 Read 的时候，读取请求头沿用 Read
+	ReadHeader time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+}
+
+// ServerWithTimeouts 设置读写超时
+// 默认设置了 ReadHeader 10s 和 Idle 120s，只有非零的字段会覆盖默认值，
+// 这样只设置 Write 的时候依旧有防御 slowloris 攻击的 ReadHeader 超时
+func ServerWithTimeouts(t Timeouts) HTTPServerOption {
+	return func(server *HTTPServer) {
+		if t.Read != 0 {
+			server.srv.ReadTimeout = t.Read
+			// 读取请求头的超时不能比 Read 更宽松
+			server.srv.ReadHeaderTimeout = 0
+		}
+		if t.ReadHeader != 0 {
+			server.srv.ReadHeaderTimeout = t.ReadHeader
+		}
+		if t.Write != 0 {
+			server.srv.WriteTimeout = t.Write
+		}
+		if t.Idle != 0 {
+			server.srv.IdleTimeout = t.Idle
+		}
+	}
+}
+
+// ServerWithH2C 允许客户端不经过 TLS 直接使用 HTTP/2（h2c）
+// 一般只用于内网流量，例如 gRPC-gateway 之类的场景
+// 注意 h2c 的连接会被接管，Shutdown 无法等待这些连接上的请求结束
+func ServerWithH2C() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.enableH2C = true
+	}
+}
+
+// ServerWithNotFoundHandler 自定义 404 的处理逻辑
+func ServerWithNotFoundHandler(handler HandleFunc) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.notFound = handler
 	}
+}
+
+// ServerWithMethodNotAllowedHandler 自定义 405 的处理逻辑
+// 在执行 handler 之前，Allow 响应头已经设置好了
+func ServerWithMethodNotAllowedHandler(handler HandleFunc) HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.methodNotAllowed = handler
+	}
+}
 
+// ServerWithAutoOptions 自动响应 OPTIONS 请求
+// 如果路径上没有显式注册 OPTIONS 路由，那么返回 204 和 Allow 响应头
+func ServerWithAutoOptions() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.autoOptions = true
+	}
+}
+
+// ServerWithCleanPath 匹配路由之前清理请求路径
+// 例如 /a//b/../c 会被当作 /a/c 处理，handler 里面看到的 Req.URL.Path 也是清理之后的
+func ServerWithCleanPath() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.cleanPath = true
+	}
+}
+
+// ServerWithRedirectTrailingSlash 在带 / 和不带 / 的路径之间重定向
+// 例如注册了 /user，那么 /user/ 会被重定向到 /user
+// GET 和 HEAD 请求使用 301，其余请求使用 308 以保留请求方法和请求体
+func ServerWithRedirectTrailingSlash() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.redirectTrailingSlash = true
+	}
+}
+
+// ServerWithCaseInsensitive 静态路由匹配的时候忽略大小写
+// 例如注册了 /user/home，那么 /USER/Home 也能命中
+func ServerWithCaseInsensitive() HTTPServerOption {
+	return func(server *HTTPServer) {
+		server.caseInsensitive = true
+	}
+}
+
+func defaultNotFound(ctx *Context) {
+	ctx.RespStatusCode = http.StatusNotFound
+	ctx.RespData = []byte("Not Found")
+}
+
+func defaultMethodNotAllowed(ctx *Context) {
+	ctx.RespStatusCode = http.StatusMethodNotAllowed
+	ctx.RespData = []byte("Method Not Allowed")
+}
+
+// ServeHTTP HTTPServer 处理请求的入口
+func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	ctx := s.pool.Get().(*Context)
+	ctx.Req = request
+	ctx.writer.reset(ctx, writer)
+	ctx.Resp = &ctx.writer
+	ctx.tplEngine = s.tplEngine
+	ctx.JSONOptions = s.jsonOptions
+	ctx.closing = s.closing
+	if s.bodyLimit > 0 {
+		ctx.SetBodyLimit(s.bodyLimit)
+	}
+	s.handler(ctx)
+	ctx.reset()
+	s.pool.Put(ctx)
+}
+
+// buildHandler 用全局 middleware 包装路由匹配的逻辑，最后把响应写回
+func (s *HTTPServer) buildHandler() HandleFunc {
 	var m Middleware = func(next HandleFunc) HandleFunc {
 		return func(ctx *Context) {
 			// 就设置好了 RespData 和 RespStatusCode
@@ -76,54 +287,317 @@ func (s *HTTPServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 			s.flashResp(ctx)
 		}
 	}
-
-	root = m(root)
-
-	root(ctx)
+	return m(compose(s.mdls, s.serve))
 }
 
 // Start 启动服务器
+// 调用 Shutdown 之后，Start 会返回 nil
 func (s *HTTPServer) Start(addr string) error {
-	return http.ListenAndServe(addr, s)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.srv.Addr = addr
+	return s.Serve(ln)
 }
 
-func (s *HTTPServer) Post(path string, handler HandleFunc) {
-	s.addRoute(http.MethodPost, path, handler)
+// StartTLS 以 HTTPS 的形式启动服务器
+func (s *HTTPServer) StartTLS(addr string, certFile string, keyFile string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.srv.Addr = addr
+	return s.ServeTLS(ln, certFile, keyFile)
+}
+
+// Serve 在 ln 上处理请求，ln 会在 Shutdown 的时候被关闭
+func (s *HTTPServer) Serve(ln net.Listener) error {
+	return s.serveListener(ln, func() error {
+		return s.srv.Serve(ln)
+	})
+}
+
+// ServeTLS 在 ln 上处理 HTTPS 请求
+func (s *HTTPServer) ServeTLS(ln net.Listener, certFile string, keyFile string) error {
+	return s.serveListener(ln, func() error {
+		return s.srv.ServeTLS(ln, certFile, keyFile)
+	})
 }
 
-func (s *HTTPServer) Get(path string, handler HandleFunc) {
-	s.addRoute(http.MethodGet, path, handler)
+func (s *HTTPServer) serveListener(ln net.Listener, serve func() error) error {
+	for _, hook := range s.onStart {
+		if err := hook(context.Background()); err != nil {
+			_ = ln.Close()
+			return err
+		}
+	}
+	err := serve()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown 优雅退出
+// 1. 执行 BeforeShutdown 注册的回调
+// 2. 拒绝新的请求，并等待已有请求处理完毕
+// 3. 执行 AfterShutdown 注册的回调
+// 任何一个步骤出错都不会中断后续步骤，最终返回第一个错误
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	if s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+
+	var firstErr error
+	for _, hook := range s.beforeShutdown {
+		if err := hook(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := s.srv.Shutdown(ctx); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	for _, hook := range s.afterShutdown {
+		if err := hook(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// OnStart 注册在开始监听之后、处理请求之前执行的回调
+// 任何一个回调返回 error，服务器都不会启动
+func (s *HTTPServer) OnStart(hooks ...Hook) {
+	s.onStart = append(s.onStart, hooks...)
+}
+
+// BeforeShutdown 注册在停止接收请求之前执行的回调
+func (s *HTTPServer) BeforeShutdown(hooks ...Hook) {
+	s.beforeShutdown = append(s.beforeShutdown, hooks...)
+}
+
+// AfterShutdown 注册在所有请求处理完毕之后执行的回调
+func (s *HTTPServer) AfterShutdown(hooks ...Hook) {
+	s.afterShutdown = append(s.afterShutdown, hooks...)
+}
+
+// anyMethods 是 Any 注册路由时使用的 HTTP 方法
+var anyMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+func (s *HTTPServer) Post(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodPost, path, handler)
+}
+
+// Get 注册 GET 路由
+// 如果同一路径没有注册 HEAD 路由，HEAD 请求也会由 handler 处理，但不会返回响应体
+func (s *HTTPServer) Get(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodGet, path, handler)
+}
+
+func (s *HTTPServer) Put(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodPut, path, handler)
+}
+
+func (s *HTTPServer) Patch(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodPatch, path, handler)
+}
+
+func (s *HTTPServer) Delete(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodDelete, path, handler)
+}
+
+func (s *HTTPServer) Head(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodHead, path, handler)
+}
+
+func (s *HTTPServer) Options(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodOptions, path, handler)
+}
+
+func (s *HTTPServer) Connect(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodConnect, path, handler)
+}
+
+func (s *HTTPServer) Trace(path string, handler HandleFunc) *Route {
+	return s.handle(http.MethodTrace, path, handler)
+}
+
+// Any 为所有的 HTTP 方法注册同一个 handler
+func (s *HTTPServer) Any(path string, handler HandleFunc) *Route {
+	return s.Handle(anyMethods, path, handler)
+}
+
+// Handle 为 methods 中的每一个 HTTP 方法注册同一个 handler
+func (s *HTTPServer) Handle(methods []string, path string, handler HandleFunc) *Route {
+	return s.register(methods, path, handler)
+}
+
+func (s *HTTPServer) handle(method string, path string, handler HandleFunc) *Route {
+	return s.Handle([]string{method}, path, handler)
 }
 
 func (s *HTTPServer) serve(ctx *Context) {
-	mi, ok := s.findRoute(ctx.Req.Method, ctx.Req.URL.Path)
+	if s.cleanPath {
+		ctx.Req.URL.Path = cleanPath(ctx.Req.URL.Path)
+	}
+	r, hostParams := s.routerOf(ctx.Req.Host)
+	mi := &ctx.mi
+	ok := r.find(ctx.Req.Method, ctx.Req.URL.Path, mi)
 	if !ok || mi.n == nil || mi.n.handler == nil {
-		ctx.RespStatusCode = http.StatusNotFound
-		ctx.RespData = []byte("Not Found")
+		s.serveNoRoute(ctx, r)
 		return
 	}
+	for key, val := range hostParams {
+		mi.addValueIfAbsent(key, val)
+	}
 	ctx.PathParams = mi.pathParams
 	ctx.Route = mi.n.route
 
-	root := mi.n.handler
-	for i := len(mi.mdls) - 1; i >= 0; i-- {
-		root = mi.mdls[i](root)
+	root := mi.chain
+	if root == nil {
+		root = compose(mi.mdls, routeHandler(mi.n.handler))
 	}
-
 	root(ctx)
 }
 
+// serveNoRoute 处理没有命中路由的请求
+// 如果路径在其它 HTTP 方法下注册了路由，那么返回 405，否则返回 404
+func (s *HTTPServer) serveNoRoute(ctx *Context, r *router) {
+	if s.redirectTrailingSlash && s.tryRedirectTrailingSlash(ctx, r) {
+		return
+	}
+	allowed := r.allowedMethods(ctx.Req.URL.Path)
+	if len(allowed) == 0 {
+		s.notFound(ctx)
+		return
+	}
+	if s.autoOptions && !containsMethod(allowed, http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+		sort.Strings(allowed)
+	}
+	ctx.Resp.Header().Set("Allow", strings.Join(allowed, ", "))
+	if s.autoOptions && ctx.Req.Method == http.MethodOptions {
+		ctx.RespStatusCode = http.StatusNoContent
+		return
+	}
+	s.methodNotAllowed(ctx)
+}
+
+// containsMethod 判断 methods 中是否有 method
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// tryRedirectTrailingSlash 尝试加上或者去掉结尾的 / 之后匹配路由，
+// 能够命中就设置好重定向的响应并返回 true
+func (s *HTTPServer) tryRedirectTrailingSlash(ctx *Context, r *router) bool {
+	p := ctx.Req.URL.Path
+	if p == "/" {
+		return false
+	}
+	mi, ok := r.findRoute(ctx.Req.Method, toggleTrailingSlash(p))
+	if !ok || mi.n.handler == nil {
+		return false
+	}
+
+	// Location 使用转义之后的路径，否则 %20、%3F 之类的字符解码之后会改变 URL 的含义
+	target := toggleTrailingSlash(ctx.Req.URL.EscapedPath())
+	if ctx.Req.URL.RawQuery != "" {
+		target += "?" + ctx.Req.URL.RawQuery
+	}
+	ctx.Resp.Header().Set("Location", target)
+	ctx.RespStatusCode = http.StatusPermanentRedirect
+	if ctx.Req.Method == http.MethodGet || ctx.Req.Method == http.MethodHead {
+		ctx.RespStatusCode = http.StatusMovedPermanently
+	}
+	return true
+}
+
+// toggleTrailingSlash 加上或者去掉结尾的 /，并且合并开头连续的 /
+// 以 // 开头的 Location 会被浏览器当作另外一个域名，例如 //evil.com/ 不能重定向到 //evil.com；
+// 转义之后的路径中 \ 是 %5C，不会被浏览器当作 /
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		p = strings.TrimRight(p, "/")
+	} else {
+		p += "/"
+	}
+	return "/" + strings.TrimLeft(p, "/")
+}
+
+// cleanPath 清理路径中的 .. 和 //，保留结尾的 /
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	res := path.Clean("/" + p)
+	if res != "/" && strings.HasSuffix(p, "/") {
+		res += "/"
+	}
+	return res
+}
+
 func (s *HTTPServer) flashResp(ctx *Context) {
+	// handler 已经直接写出了响应
+	if ctx.writer.Written() {
+		return
+	}
+	writeResp(ctx)
+}
+
+// writeResp 把 RespStatusCode 和 RespData 写入 ctx.Resp
+// HEAD 请求没有响应体，handler 自己设置了 Content-Length 的时候不会覆盖，
+// 例如 HEAD 请求交给 http.ServeContent 处理
+// 请求体超过限制的时候，不管 handler 怎么处理，都响应 413。
+// WrapMiddleware 也会调用 writeResp，所以在这里而不是在 HTTPServer 中处理
+func writeResp(ctx *Context) {
+	header := ctx.Resp.Header()
+	if ctx.body.exceeded {
+		header.Set("Connection", "close")
+		ctx.RespStatusCode = http.StatusRequestEntityTooLarge
+		ctx.RespData = []byte(http.StatusText(http.StatusRequestEntityTooLarge))
+	}
+	if bodyAllowed(ctx.RespStatusCode) &&
+		(ctx.Req.Method != http.MethodHead || header.Get("Content-Length") == "") {
+		header.Set("Content-Length", strconv.Itoa(len(ctx.RespData)))
+	}
 	if ctx.RespStatusCode > 0 {
 		ctx.Resp.WriteHeader(ctx.RespStatusCode)
 	}
-	ctx.Resp.Header().Set("Content-Length", strconv.Itoa(len(ctx.RespData)))
+	// HEAD 请求可能是由 GET 的 handler 处理的，不能返回响应体
+	if ctx.Req.Method == http.MethodHead {
+		return
+	}
 	_, err := ctx.Resp.Write(ctx.RespData)
 	if err != nil {
 		fmt.Printf("写响应失败")
 	}
 }
 
+// bodyAllowed 判断响应码是否允许有响应体，1xx、204 和 304 不允许
+func bodyAllowed(status int) bool {
+	return !(status >= 100 && status < 200) &&
+		status != http.StatusNoContent && status != http.StatusNotModified
+}
+
 func (s *HTTPServer) Use(method string, path string, ms ...Middleware) {
 	s.addRoute(method, path, nil, ms...)
 }
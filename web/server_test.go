@@ -1 +1,471 @@
 package web
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHTTPServer_Shutdown(t *testing.T) {
+	s := NewHTTPServer(ServerWithShutdownTimeout(time.Second))
+	var seq []string
+	started := make(chan struct{})
+	s.OnStart(func(ctx context.Context) error {
+		seq = append(seq, "start")
+		close(started)
+		return nil
+	})
+	s.BeforeShutdown(func(ctx context.Context) error {
+		seq = append(seq, "before")
+		return nil
+	})
+	s.AfterShutdown(func(ctx context.Context) error {
+		seq = append(seq, "after")
+		return errors.New("after error")
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start("127.0.0.1:0")
+	}()
+	<-started
+
+	err := s.Shutdown(context.Background())
+	assert.Equal(t, errors.New("after error"), err)
+	require.NoError(t, <-errCh)
+	assert.Equal(t, []string{"start", "before", "after"}, seq)
+}
+
+func TestHTTPServer_OnStartError(t *testing.T) {
+	s := NewHTTPServer()
+	s.OnStart(func(ctx context.Context) error {
+		return errors.New("start error")
+	})
+	err := s.Start("127.0.0.1:0")
+	assert.Equal(t, errors.New("start error"), err)
+}
+
+func TestHTTPServer_Serve(t *testing.T) {
+	testCases := []struct {
+		name      string
+		opts      []HTTPServerOption
+		client    *http.Client
+		wantProto string
+	}{
+		{
+			name:      "http1",
+			client:    http.DefaultClient,
+			wantProto: "HTTP/1.1",
+		},
+		{
+			name: "h2c",
+			opts: []HTTPServerOption{ServerWithH2C()},
+			client: &http.Client{
+				Transport: &http2.Transport{
+					AllowHTTP: true,
+					DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+						return net.Dial(network, addr)
+					},
+				},
+			},
+			wantProto: "HTTP/2.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			s.Get("/proto", func(ctx *Context) {
+				ctx.RespData = []byte(ctx.Req.Proto)
+			})
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go func() {
+				_ = s.Serve(ln)
+			}()
+			defer func() {
+				_ = s.Shutdown(context.Background())
+			}()
+
+			resp, err := tc.client.Get("http://" + ln.Addr().String() + "/proto")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantProto, string(body))
+		})
+	}
+}
+
+func TestServerWithTimeouts(t *testing.T) {
+	testCases := []struct {
+		name           string
+		timeouts       Timeouts
+		wantRead       time.Duration
+		wantReadHeader time.Duration
+		wantWrite      time.Duration
+		wantIdle       time.Duration
+	}{
+		{
+			// 只设置 Write 的时候保留默认的 ReadHeader 和 Idle
+			name:           "write only",
+			timeouts:       Timeouts{Write: 5 * time.Second},
+			wantReadHeader: 10 * time.Second,
+			wantWrite:      5 * time.Second,
+			wantIdle:       120 * time.Second,
+		},
+		{
+			name:      "read",
+			timeouts:  Timeouts{Read: time.Second, Write: 2 * time.Second},
+			wantRead:  time.Second,
+			wantWrite: 2 * time.Second,
+			wantIdle:  120 * time.Second,
+		},
+		{
+			name:           "all",
+			timeouts:       Timeouts{Read: time.Second, ReadHeader: time.Second, Write: time.Second, Idle: -1},
+			wantRead:       time.Second,
+			wantReadHeader: time.Second,
+			wantWrite:      time.Second,
+			wantIdle:       -1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(ServerWithTimeouts(tc.timeouts))
+			assert.Equal(t, tc.wantRead, s.srv.ReadTimeout)
+			assert.Equal(t, tc.wantReadHeader, s.srv.ReadHeaderTimeout)
+			assert.Equal(t, tc.wantWrite, s.srv.WriteTimeout)
+			assert.Equal(t, tc.wantIdle, s.srv.IdleTimeout)
+		})
+	}
+}
+
+func TestHTTPServer_Handle(t *testing.T) {
+	s := NewHTTPServer()
+	handler := func(ctx *Context) {
+		ctx.RespData = []byte(ctx.Req.Method)
+	}
+	s.Put("/put", handler)
+	s.Patch("/patch", handler)
+	s.Delete("/delete", handler)
+	s.Options("/options", handler)
+	s.Trace("/trace", handler)
+	s.Connect("/connect", handler)
+	s.Get("/get", handler)
+	s.Any("/any", handler)
+	s.Handle([]string{http.MethodGet, http.MethodPost}, "/handle", handler)
+
+	testCases := []struct {
+		method   string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{method: http.MethodPut, path: "/put", wantCode: http.StatusOK, wantBody: http.MethodPut},
+		{method: http.MethodPatch, path: "/patch", wantCode: http.StatusOK, wantBody: http.MethodPatch},
+		{method: http.MethodDelete, path: "/delete", wantCode: http.StatusOK, wantBody: http.MethodDelete},
+		{method: http.MethodOptions, path: "/options", wantCode: http.StatusOK, wantBody: http.MethodOptions},
+		{method: http.MethodTrace, path: "/trace", wantCode: http.StatusOK, wantBody: http.MethodTrace},
+		{method: http.MethodConnect, path: "/connect", wantCode: http.StatusOK, wantBody: http.MethodConnect},
+		{method: http.MethodPatch, path: "/any", wantCode: http.StatusOK, wantBody: http.MethodPatch},
+		{method: http.MethodPost, path: "/handle", wantCode: http.StatusOK, wantBody: http.MethodPost},
+		{method: http.MethodPut, path: "/handle", wantCode: http.StatusMethodNotAllowed, wantBody: "Method Not Allowed"},
+		// HEAD 使用 GET 的 handler，但是没有响应体
+		{method: http.MethodHead, path: "/get", wantCode: http.StatusOK, wantBody: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.method+tc.path, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+		})
+	}
+}
+
+func TestHTTPServer_NoRoute(t *testing.T) {
+	handler := func(ctx *Context) {}
+	testCases := []struct {
+		name      string
+		opts      []HTTPServerOption
+		method    string
+		path      string
+		wantCode  int
+		wantBody  string
+		wantAllow string
+	}{
+		{
+			name:     "not found",
+			method:   http.MethodGet,
+			path:     "/abc",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:      "method not allowed",
+			method:    http.MethodPut,
+			path:      "/user",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "Method Not Allowed",
+			wantAllow: "DELETE, GET, HEAD",
+		},
+		{
+			name:      "options without auto options",
+			method:    http.MethodOptions,
+			path:      "/user",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "Method Not Allowed",
+			wantAllow: "DELETE, GET, HEAD",
+		},
+		{
+			name:      "auto options",
+			opts:      []HTTPServerOption{ServerWithAutoOptions()},
+			method:    http.MethodOptions,
+			path:      "/user",
+			wantCode:  http.StatusNoContent,
+			wantAllow: "DELETE, GET, HEAD, OPTIONS",
+		},
+		{
+			// 显式注册了 OPTIONS 路由，Allow 里面不会重复出现 OPTIONS
+			name:      "auto options with explicit options",
+			opts:      []HTTPServerOption{ServerWithAutoOptions()},
+			method:    http.MethodDelete,
+			path:      "/options",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "Method Not Allowed",
+			wantAllow: "GET, HEAD, OPTIONS",
+		},
+		{
+			name: "custom handlers",
+			opts: []HTTPServerOption{
+				ServerWithNotFoundHandler(func(ctx *Context) {
+					ctx.RespStatusCode = http.StatusNotFound
+					ctx.RespData = []byte("custom 404")
+				}),
+				ServerWithMethodNotAllowedHandler(func(ctx *Context) {
+					ctx.RespStatusCode = http.StatusMethodNotAllowed
+					ctx.RespData = []byte("custom 405")
+				}),
+			},
+			method:    http.MethodPost,
+			path:      "/user",
+			wantCode:  http.StatusMethodNotAllowed,
+			wantBody:  "custom 405",
+			wantAllow: "DELETE, GET, HEAD",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			s.Get("/user", handler)
+			s.Delete("/user", handler)
+			s.Get("/options", handler)
+			s.Options("/options", handler)
+			// 只注册了 middleware 的节点不算路由
+			s.Use(http.MethodPost, "/user", func(next HandleFunc) HandleFunc { return next })
+
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantAllow, recorder.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestHTTPServer_PathNormalization(t *testing.T) {
+	testCases := []struct {
+		name         string
+		opts         []HTTPServerOption
+		method       string
+		path         string
+		wantCode     int
+		wantBody     string
+		wantLocation string
+	}{
+		{
+			name:     "no clean",
+			method:   http.MethodGet,
+			path:     "/user//home",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "clean",
+			opts:     []HTTPServerOption{ServerWithCleanPath()},
+			method:   http.MethodGet,
+			path:     "/user//abc/../home",
+			wantCode: http.StatusOK,
+			wantBody: "/user/home",
+		},
+		{
+			name:     "no redirect",
+			method:   http.MethodGet,
+			path:     "/user/",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:         "redirect get",
+			opts:         []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:       http.MethodGet,
+			path:         "/user/?a=b",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user?a=b",
+		},
+		{
+			name:         "redirect post",
+			opts:         []HTTPServerOption{ServerWithRedirectTrailingSlash()},
+			method:       http.MethodPost,
+			path:         "/user/",
+			wantCode:     http.StatusPermanentRedirect,
+			wantLocation: "/user",
+		},
+		{
+			name:         "clean and redirect",
+			opts:         []HTTPServerOption{ServerWithCleanPath(), ServerWithRedirectTrailingSlash()},
+			method:       http.MethodGet,
+			path:         "/user//home/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/user/home",
+		},
+		{
+			name:     "case sensitive",
+			method:   http.MethodGet,
+			path:     "/USER/Home",
+			wantCode: http.StatusNotFound,
+			wantBody: "Not Found",
+		},
+		{
+			name:     "case insensitive",
+			opts:     []HTTPServerOption{ServerWithCaseInsensitive()},
+			method:   http.MethodGet,
+			path:     "/USER/Home",
+			wantCode: http.StatusOK,
+			wantBody: "/USER/Home",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(tc.opts...)
+			handler := func(ctx *Context) {
+				ctx.RespData = []byte(ctx.Req.URL.Path)
+			}
+			s.Get("/user", handler)
+			s.Post("/user", handler)
+			s.Get("/user/home", handler)
+
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantBody, recorder.Body.String())
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func TestHTTPServer_RedirectTrailingSlash_Location(t *testing.T) {
+	testCases := []struct {
+		name         string
+		route        string
+		path         string
+		wantCode     int
+		wantLocation string
+	}{
+		{
+			name:     "two params",
+			route:    "/:a/:b",
+			path:     "//evil.com/",
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:         "collapse leading slashes",
+			route:        "/:a",
+			path:         "//evil.com/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/evil.com",
+		},
+		{
+			name:         "backslash",
+			route:        "/:a",
+			path:         "/\\evil.com/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/%5Cevil.com",
+		},
+		{
+			name:         "escaped path",
+			route:        "/a b",
+			path:         "/a%20b/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/a%20b",
+		},
+		{
+			name:         "escaped question mark",
+			route:        "/:a",
+			path:         "/a%3Fb=c/",
+			wantCode:     http.StatusMovedPermanently,
+			wantLocation: "/a%3Fb=c",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewHTTPServer(ServerWithRedirectTrailingSlash())
+			s.Get(tc.route, func(ctx *Context) {})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			u, err := url.ParseRequestURI(tc.path)
+			require.NoError(t, err)
+			req.URL = u
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
+
+func BenchmarkHTTPServer_ServeHTTP(b *testing.B) {
+	s := NewHTTPServer(ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+		}
+	}))
+	s.Get("/user/:id/order/:oid", func(ctx *Context) {})
+	req := httptest.NewRequest(http.MethodGet, "/user/123/order/456", nil)
+	w := &discardWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.ServeHTTP(w, req)
+	}
+}
+
+// discardWriter 丢弃所有的响应，避免 httptest.ResponseRecorder 的内存分配干扰 benchmark
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteHeader(statusCode int) {}
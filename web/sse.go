@@ -0,0 +1,198 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEStream 是 Server-Sent Events 的响应流
+// 每次写入都会立刻 Flush，客户端断开连接之后写入会返回请求的 context 的错误，
+// 服务器 Shutdown 之后写入会返回 http.ErrServerClosed
+// SSEStream 的方法可以并发调用
+type SSEStream struct {
+	// w 和 reqCtx 在调用 SSE 的时候就取出来，
+	// 之后 middleware 修改 ctx.Resp 和 ctx.Req 不会影响 SSEStream
+	w      http.ResponseWriter
+	f      http.Flusher
+	reqCtx context.Context
+
+	mu     sync.Mutex
+	closed bool
+	stop   chan struct{}
+	// done 在客户端断开连接、服务器 Shutdown 或者 SSEStream 关闭的时候关闭
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SSE 把响应切换成 Server-Sent Events
+// 调用之后响应头已经写出，handler 应该只通过返回的 SSEStream 写入数据，
+// 一般的用法是在循环中 select Done() 和业务数据，客户端断开连接之后返回
+// 路由的 handler 返回的时候 SSEStream 会被自动关闭，心跳也随之停止
+func (c *Context) SSE() (*SSEStream, error) {
+	f, ok := c.Resp.(http.Flusher)
+	if !ok {
+		return nil, errors.New("web: http.ResponseWriter 不支持 Flush，无法使用 SSE")
+	}
+	header := c.Resp.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// 避免 nginx 之类的反向代理缓冲响应
+	header.Set("X-Accel-Buffering", "no")
+	c.Resp.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	s := &SSEStream{
+		w:      c.Resp,
+		f:      f,
+		reqCtx: c.Req.Context(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.watch(c.Req.Context().Done(), c.closing)
+	c.sse = s
+	return s, nil
+}
+
+// watch 等待客户端断开连接或者服务器 Shutdown，然后关闭 done
+func (s *SSEStream) watch(reqDone <-chan struct{}, closing <-chan struct{}) {
+	defer s.wg.Done()
+	select {
+	case <-reqDone:
+	case <-closing:
+	case <-s.stop:
+	}
+	close(s.done)
+}
+
+// Done 在客户端断开连接或者服务器开始 Shutdown 的时候关闭
+// handler 应该在 Done 关闭之后尽快返回，否则 Shutdown 会一直等到超时
+func (s *SSEStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Send 发送一个事件，event 和 id 为空的时候不发送对应的字段
+// data 中的换行会被拆分成多个 data 字段，客户端收到的依旧是原本的 data，
+// 换行包括 \r\n、\n 以及单独的 \r，否则 data 可以伪造别的字段
+func (s *SSEStream) Send(event string, id string, data string) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return errors.New("web: SSE 的 event 和 id 不能包含换行，包括单独的 \\r")
+	}
+	var sb strings.Builder
+	if event != "" {
+		sb.WriteString("event: ")
+		sb.WriteString(event)
+		sb.WriteByte('\n')
+	}
+	if id != "" {
+		sb.WriteString("id: ")
+		sb.WriteString(id)
+		sb.WriteByte('\n')
+	}
+	for _, line := range splitLines(data) {
+		sb.WriteString("data: ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	return s.write(sb.String())
+}
+
+// Retry 告诉客户端断线之后等待多久重连
+func (s *SSEStream) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Comment 发送注释，客户端会忽略注释，一般用来保持连接
+func (s *SSEStream) Comment(text string) error {
+	var sb strings.Builder
+	for _, line := range splitLines(text) {
+		sb.WriteString(": ")
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	return s.write(sb.String())
+}
+
+// Heartbeat 每隔 interval 发送一条注释，避免连接因为空闲被代理断开
+// 客户端断开连接、服务器 Shutdown 或者 SSEStream 被关闭之后停止
+func (s *SSEStream) Heartbeat(interval time.Duration) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			case <-s.Done():
+				return
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 关闭 SSEStream，等待心跳停止，之后的写入都会返回错误
+// handler 返回的时候会自动调用，重复调用没有影响
+func (s *SSEStream) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.stop)
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *SSEStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("web: SSEStream 已经关闭")
+	}
+	select {
+	case <-s.done:
+		if err := s.reqCtx.Err(); err != nil {
+			return err
+		}
+		return http.ErrServerClosed
+	default:
+	}
+	if _, err := s.w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}
+
+// splitLines 按照 SSE 规范中的换行拆分 text：\r\n、\n 和单独的 \r
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return strings.Split(text, "\n")
+}
+
+// closeSSE 在路由的 handler 返回的时候关闭 SSEStream，
+// 避免心跳在 middleware 收尾的时候继续写入响应
+func closeSSE(handler HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		handler(ctx)
+		if ctx.sse != nil {
+			ctx.sse.Close()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContext_SSE(t *testing.T) {
+	var status int
+	s := NewHTTPServer(ServerWithMiddleware(func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			next(ctx)
+			status = ctx.RespStatusCode
+		}
+	}))
+	s.Get("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		require.NoError(t, err)
+		require.NoError(t, stream.Retry(3*time.Second))
+		require.NoError(t, stream.Send("progress", "1", "10%"))
+		require.NoError(t, stream.Send("", "", "line1\nline2"))
+		require.NoError(t, stream.Comment("ping"))
+		assert.Error(t, stream.Send("bad\nevent", "", "data"))
+		assert.Error(t, stream.Send("", "bad\rid", "data"))
+		// 单独的 \r 也是换行，data 不能借此伪造别的字段
+		require.NoError(t, stream.Send("msg", "", "hello\revent: evil"))
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", recorder.Header().Get("Cache-Control"))
+	assert.True(t, recorder.Flushed)
+	assert.Equal(t, "retry: 3000\n\n"+
+		"event: progress\nid: 1\ndata: 10%\n\n"+
+		"data: line1\ndata: line2\n\n"+
+		": ping\n\n"+
+		"event: msg\ndata: hello\ndata: event: evil\n\n", recorder.Body.String())
+}
+
+func TestContext_SSE_WrapMiddleware(t *testing.T) {
+	mw := func(next http.Handler) http.Handler {
+		return next
+	}
+	s := NewHTTPServer(ServerWithMiddleware(WrapMiddleware(mw)))
+	s.Get("/events", func(ctx *Context) {
+		stream, err := ctx.SSE()
+		require.NoError(t, err)
+		stream.Heartbeat(time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+	// handler 返回之后心跳已经停止，响应不会再变化
+	body := recorder.Body.String()
+	assert.Contains(t, body, ": heartbeat\n\n")
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, body, recorder.Body.String())
+}
+
+func TestContext_SSE_Disconnect(t *testing.T) {
+	s := NewHTTPServer()
+	done := make(chan struct{})
+	s.Get("/events", func(ctx *Context) {
+		defer close(done)
+		stream, err := ctx.SSE()
+		require.NoError(t, err)
+		stream.Heartbeat(10 * time.Millisecond)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for i := 0; ; i++ {
+			select {
+			case <-stream.Done():
+				return
+			case <-ticker.C:
+				if i == 0 {
+					_ = stream.Send("tick", "", "0")
+				}
+			}
+		}
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/events", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 4 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line = strings.TrimSuffix(line, "\n"); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, []string{"event: tick", "data: 0", ": heartbeat", ": heartbeat"}, lines)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("客户端断开连接之后 handler 没有返回")
+	}
+}
+
+func TestContext_SSE_Shutdown(t *testing.T) {
+	s := NewHTTPServer(ServerWithShutdownTimeout(5 * time.Second))
+	done := make(chan struct{})
+	s.Get("/events", func(ctx *Context) {
+		defer close(done)
+		stream, err := ctx.SSE()
+		require.NoError(t, err)
+		stream.Heartbeat(time.Hour)
+		require.NoError(t, stream.Send("", "", "hello"))
+		<-stream.Done()
+		assert.Equal(t, http.ErrServerClosed, stream.Send("", "", "bye"))
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(ln)
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: hello\n", line)
+
+	start := time.Now()
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Less(t, time.Since(start), time.Second)
+	<-done
+}
@@ -7,3 +7,11 @@ type TemplateEngine interface {
 	// data 是渲染页面所需要的数据
 	Render(ctx context.Context, tplName string, data any) ([]byte, error)
 }
+
+// TemplateFuncsSetter 是 TemplateEngine 可选实现的接口
+// HTTPServer 创建的时候会通过它注册框架提供的模板函数，例如 url
+// 注意 Go 模板要求在解析的时候函数就已经存在，
+// 所以模板需要先使用同名的函数占位，之后才会被替换为真正的实现
+type TemplateFuncsSetter interface {
+	Funcs(funcs map[string]any)
+}
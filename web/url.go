@@ -0,0 +1,110 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URLFuncName 是注册到 TemplateEngine 中的反向生成 URL 的模板函数名字
+// 在模板中使用：{{ url "user.show" "id" "42" }}
+const URLFuncName = "url"
+
+// Route 代表一条注册好的路由，用于在注册之后给路由命名
+type Route struct {
+	r    *router
+	path string
+}
+
+// Name 给路由命名，之后可以通过 HTTPServer.URL 反向生成 URL
+// 同一个名字不能注册两次
+func (r *Route) Name(name string) *Route {
+	if old, ok := r.r.names[name]; ok {
+		panic(fmt.Sprintf("web: 路由名字冲突 [%s]，已有 %s，新注册 %s", name, old, r.path))
+	}
+	r.r.names[name] = r.path
+	return r
+}
+
+// URL 根据路由名字和路径参数生成 URL
+// 路径参数的值会被转义，正则路由的参数值必须满足对应的正则表达式
+func (r *router) URL(name string, params map[string]string) (string, error) {
+	path, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("web: 路由 %s 不存在", name)
+	}
+	if path == "/" {
+		return path, nil
+	}
+
+	var sb strings.Builder
+	for _, seg := range strings.Split(path, "/")[1:] {
+		sb.WriteByte('/')
+		if seg == "*" {
+			val, ok := params["*"]
+			if !ok {
+				return "", fmt.Errorf("web: 路由 %s 缺少通配符的值", name)
+			}
+			sb.WriteString(url.PathEscape(val))
+			continue
+		}
+		if isCatchAll(seg) {
+			val, ok := params[seg[1:]]
+			if !ok {
+				return "", fmt.Errorf("web: 路由 %s 缺少路径参数 %s", name, seg[1:])
+			}
+			// 命名通配符的值可以包含 /，逐段转义
+			parts := strings.Split(strings.TrimPrefix(val, "/"), "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			sb.WriteString(strings.Join(parts, "/"))
+			continue
+		}
+		if seg[0] != ':' {
+			sb.WriteString(seg)
+			continue
+		}
+
+		paramName, reg, isReg := regParam(seg)
+		if !isReg {
+			paramName = seg[1:]
+		}
+		val, ok := params[paramName]
+		if !ok {
+			return "", fmt.Errorf("web: 路由 %s 缺少路径参数 %s", name, paramName)
+		}
+		if isReg && !reg.MatchString(val) {
+			return "", fmt.Errorf("web: 路由 %s 的路径参数 %s 不满足 %s，值 %s", name, paramName, seg, val)
+		}
+		sb.WriteString(url.PathEscape(val))
+	}
+	return sb.String(), nil
+}
+
+// URL 根据路由名字和路径参数生成 URL
+// 先查找直接注册在 HTTPServer 上的路由，再按照注册顺序查找域名路由
+func (s *HTTPServer) URL(name string, params map[string]string) (string, error) {
+	if _, ok := s.names[name]; ok || len(s.hosts) == 0 {
+		return s.router.URL(name, params)
+	}
+	for _, h := range s.hosts {
+		if _, ok := h.names[name]; ok {
+			return h.URL(name, params)
+		}
+	}
+	return s.router.URL(name, params)
+}
+
+// urlFunc 是提供给模板使用的 URL 函数
+// 路径参数以 key, value 的形式依次传入
+func (s *HTTPServer) urlFunc(name string, kvs ...string) (string, error) {
+	if len(kvs)%2 != 0 {
+		return "", fmt.Errorf("web: 路由 %s 的路径参数必须成对出现", name)
+	}
+	params := make(map[string]string, len(kvs)/2)
+	for i := 0; i < len(kvs); i += 2 {
+		params[kvs[i]] = kvs[i+1]
+	}
+	return s.URL(name, params)
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHTTPServer_URL(t *testing.T) {
+	handler := func(ctx *Context) {}
+	s := NewHTTPServer()
+	s.Get("/", handler).Name("home")
+	s.Get("/user/:id", handler).Name("user.show")
+	s.Post("/order/:id(^[0-9]+$)/detail", handler).Name("order.detail")
+	s.Get("/static/*", handler).Name("static")
+	s.Get("/item/:id<int>", handler).Name("item")
+	s.Group("/api").Get("/user/:name", handler).Name("api.user")
+
+	testCases := []struct {
+		name    string
+		route   string
+		params  map[string]string
+		wantURL string
+		wantErr error
+	}{
+		{
+			name:    "root",
+			route:   "home",
+			wantURL: "/",
+		},
+		{
+			name:    "param",
+			route:   "user.show",
+			params:  map[string]string{"id": "42"},
+			wantURL: "/user/42",
+		},
+		{
+			name:    "escape",
+			route:   "user.show",
+			params:  map[string]string{"id": "a b/c"},
+			wantURL: "/user/a%20b%2Fc",
+		},
+		{
+			name:    "regexp",
+			route:   "order.detail",
+			params:  map[string]string{"id": "123"},
+			wantURL: "/order/123/detail",
+		},
+		{
+			name:    "regexp mismatch",
+			route:   "order.detail",
+			params:  map[string]string{"id": "abc"},
+			wantErr: errors.New("web: 路由 order.detail 的路径参数 id 不满足 :id(^[0-9]+$)，值 abc"),
+		},
+		{
+			name:    "typed",
+			route:   "item",
+			params:  map[string]string{"id": "1"},
+			wantURL: "/item/1",
+		},
+		{
+			name:    "typed mismatch",
+			route:   "item",
+			params:  map[string]string{"id": "a"},
+			wantErr: errors.New("web: 路由 item 的路径参数 id 不满足 :id<int>，值 a"),
+		},
+		{
+			name:    "star",
+			route:   "static",
+			params:  map[string]string{"*": "a.png"},
+			wantURL: "/static/a.png",
+		},
+		{
+			name:    "group",
+			route:   "api.user",
+			params:  map[string]string{"name": "tom"},
+			wantURL: "/api/user/tom",
+		},
+		{
+			name:    "missing param",
+			route:   "user.show",
+			wantErr: errors.New("web: 路由 user.show 缺少路径参数 id"),
+		},
+		{
+			name:    "unknown route",
+			route:   "abc",
+			wantErr: errors.New("web: 路由 abc 不存在"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := s.URL(tc.route, tc.params)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantURL, u)
+		})
+	}
+
+	assert.PanicsWithValue(t, "web: 路由名字冲突 [home]，已有 /，新注册 /abc", func() {
+		s.Get("/abc", handler).Name("home")
+	})
+}
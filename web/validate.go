@@ -0,0 +1,388 @@
+package web
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidateFunc 是自定义的校验规则
+// field 是字段的值，param 是规则中 = 后面的参数，
+// parent 是字段所在的结构体，可以用来实现跨字段的校验
+type ValidateFunc func(field reflect.Value, param string, parent reflect.Value) bool
+
+// validators 是校验规则的名字到校验函数的映射
+var validators = map[string]ValidateFunc{}
+
+// checkedTypes 缓存结构体的 validate 标签检查结果，reflect.Type => error
+var checkedTypes sync.Map
+
+func init() {
+	RegisterValidator("required", validateRequired)
+	RegisterValidator("min", validateMin)
+	RegisterValidator("max", validateMax)
+	RegisterValidator("len", validateLen)
+	RegisterValidator("email", validateEmail)
+	RegisterValidator("oneof", validateOneOf)
+	RegisterValidator("eqfield", crossField(func(c int) bool { return c == 0 }))
+	RegisterValidator("nefield", crossField(func(c int) bool { return c != 0 }))
+	RegisterValidator("gtfield", crossField(func(c int) bool { return c > 0 }))
+	RegisterValidator("gtefield", crossField(func(c int) bool { return c >= 0 }))
+	RegisterValidator("ltfield", crossField(func(c int) bool { return c < 0 }))
+	RegisterValidator("ltefield", crossField(func(c int) bool { return c <= 0 }))
+}
+
+// RegisterValidator 注册校验规则，注册之后就可以在 validate 标签中使用
+// 同名规则会被覆盖。需要在校验之前调用，并且不是并发安全的
+func RegisterValidator(name string, fn ValidateFunc) {
+	validators[name] = fn
+	// 之前因为规则未知而检查失败的结构体需要重新检查
+	checkedTypes.Range(func(key, _ any) bool {
+		checkedTypes.Delete(key)
+		return true
+	})
+}
+
+// Validate 按照 validate 标签校验 val，val 可以是结构体、结构体指针或者它们的切片
+// 标签由逗号分隔的规则组成，例如 validate:"required,min=3,max=64"，内置的规则有：
+//   - required 不能是零值，字符串、切片和 map 不能为空
+//   - omitempty 字段是零值的时候跳过剩下的规则
+//   - min=N、max=N、len=N 数字比较值，字符串比较字符数，切片和 map 比较长度
+//   - email 合法的邮箱地址
+//   - oneof=a b 必须是空格分隔的值中的一个
+//   - eqfield=F、nefield=F、gtfield=F、gtefield=F、ltfield=F、ltefield=F 和同一个结构体中的字段 F 比较
+//
+// 没有 validate 标签的结构体字段以及结构体切片会被递归校验。
+// 所有字段的校验错误会被收集到 ValidationErrors 中一起返回。
+// 标签中有未知的规则或者非法的参数的时候返回普通的 error，这是代码的问题而不是请求的问题；
+// 每个结构体类型的标签只会检查一次
+func Validate(val any) error {
+	var errs ValidationErrors
+	if err := validateValue(reflect.ValueOf(val), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateValue(v reflect.Value, name string, errs *ValidationErrors) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		return validateStruct(v, name, errs)
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", name, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	t := v.Type()
+	if err := checkTags(t); err != nil {
+		return err
+	}
+	if prefix != "" {
+		prefix += "."
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fv := v.Field(i)
+		name := prefix + f.Name
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" && !validateField(fv, tag, v, name, errs) {
+			continue
+		}
+		if err := validateValue(fv, name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTags 检查结构体 t 的 validate 标签，结果会被缓存
+// 只检查 t 自己的字段，嵌套的结构体在校验到的时候再检查
+func checkTags(t reflect.Type) error {
+	if res, ok := checkedTypes.Load(t); ok {
+		if res == nil {
+			return nil
+		}
+		return res.(error)
+	}
+	err := doCheckTags(t)
+	checkedTypes.Store(t, err)
+	return err
+}
+
+func doCheckTags(t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("validate")
+		if !f.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(rule, "=")
+			if ruleName == "omitempty" {
+				continue
+			}
+			if _, ok := validators[ruleName]; !ok {
+				return fmt.Errorf("web: 字段 %s.%s 使用了未知的校验规则 [%s]", t.Name(), f.Name, ruleName)
+			}
+			switch ruleName {
+			case "min", "max", "len":
+				if _, err := strconv.ParseFloat(param, 64); err != nil {
+					return fmt.Errorf("web: 字段 %s.%s 的校验规则 %s 的参数 %s 不是数字", t.Name(), f.Name, ruleName, param)
+				}
+			case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+				if _, ok := t.FieldByName(param); !ok {
+					return fmt.Errorf("web: 字段 %s.%s 的校验规则 %s 引用的字段 %s 不存在", t.Name(), f.Name, ruleName, param)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateField 按照 tag 校验字段，遇到第一个失败的规则就停止
+// 返回字段是否通过了校验
+func validateField(fv reflect.Value, tag string, parent reflect.Value, name string, errs *ValidationErrors) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		ruleName, param, _ := strings.Cut(rule, "=")
+		if ruleName == "omitempty" {
+			if isEmpty(fv) {
+				return true
+			}
+			continue
+		}
+		// 规则在 checkTags 中检查过了
+		fn := validators[ruleName]
+		field := fv
+		// 除了 required 之外，其它规则都校验指针指向的值，nil 指针只有 required 会失败
+		if ruleName != "required" {
+			for field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					break
+				}
+				field = field.Elem()
+			}
+			if field.Kind() == reflect.Pointer {
+				continue
+			}
+		}
+		if !fn(field, param, parent) {
+			*errs = append(*errs, &ValidationError{
+				Field:   name,
+				Rule:    ruleName,
+				Param:   param,
+				Message: validationMessage(name, ruleName, param),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+func validationMessage(name string, rule string, param string) string {
+	switch rule {
+	case "required":
+		return name + " 不能为空"
+	case "min":
+		return fmt.Sprintf("%s 不能小于 %s", name, param)
+	case "max":
+		return fmt.Sprintf("%s 不能大于 %s", name, param)
+	case "len":
+		return fmt.Sprintf("%s 的长度必须是 %s", name, param)
+	case "email":
+		return name + " 不是合法的邮箱地址"
+	case "oneof":
+		return fmt.Sprintf("%s 必须是 [%s] 中的一个", name, param)
+	case "eqfield":
+		return fmt.Sprintf("%s 必须等于 %s", name, param)
+	case "nefield":
+		return fmt.Sprintf("%s 不能等于 %s", name, param)
+	case "gtfield":
+		return fmt.Sprintf("%s 必须大于 %s", name, param)
+	case "gtefield":
+		return fmt.Sprintf("%s 必须大于等于 %s", name, param)
+	case "ltfield":
+		return fmt.Sprintf("%s 必须小于 %s", name, param)
+	case "ltefield":
+		return fmt.Sprintf("%s 必须小于等于 %s", name, param)
+	}
+	if param != "" {
+		return fmt.Sprintf("%s 不满足校验规则 %s=%s", name, rule, param)
+	}
+	return fmt.Sprintf("%s 不满足校验规则 %s", name, rule)
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func validateRequired(field reflect.Value, _ string, _ reflect.Value) bool {
+	return !isEmpty(field)
+}
+
+// size 返回比较 min、max 和 len 时使用的值
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// compareSize 参数不是数字的时候校验失败，Validate 在 checkTags 中已经检查过参数了
+func compareSize(field reflect.Value, param string, cmp func(s, p float64) bool) bool {
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return false
+	}
+	s, ok := size(field)
+	return ok && cmp(s, p)
+}
+
+func validateMin(field reflect.Value, param string, _ reflect.Value) bool {
+	return compareSize(field, param, func(s, p float64) bool { return s >= p })
+}
+
+func validateMax(field reflect.Value, param string, _ reflect.Value) bool {
+	return compareSize(field, param, func(s, p float64) bool { return s <= p })
+}
+
+func validateLen(field reflect.Value, param string, _ reflect.Value) bool {
+	return compareSize(field, param, func(s, p float64) bool { return s == p })
+}
+
+func validateEmail(field reflect.Value, _ string, _ reflect.Value) bool {
+	if field.Kind() != reflect.String {
+		return false
+	}
+	addr, err := mail.ParseAddress(field.String())
+	return err == nil && addr.Address == field.String()
+}
+
+func validateOneOf(field reflect.Value, param string, _ reflect.Value) bool {
+	val := fmt.Sprint(field.Interface())
+	for _, opt := range strings.Fields(param) {
+		if opt == val {
+			return true
+		}
+	}
+	return false
+}
+
+// crossField 返回和同一个结构体中的另一个字段比较的校验函数
+// 引用的字段不存在的时候校验失败
+func crossField(ok func(c int) bool) ValidateFunc {
+	return func(field reflect.Value, param string, parent reflect.Value) bool {
+		other := parent.FieldByName(param)
+		if !other.IsValid() {
+			return false
+		}
+		for other.Kind() == reflect.Pointer {
+			if other.IsNil() {
+				return false
+			}
+			other = other.Elem()
+		}
+		c, canCompare := compareValue(field, other)
+		return canCompare && ok(c)
+	}
+}
+
+// compareValue 比较两个值，第二个返回值表示两个值是否可以比较
+func compareValue(a reflect.Value, b reflect.Value) (int, bool) {
+	if a.Type() != b.Type() {
+		return 0, false
+	}
+	if a.Type() == timeType {
+		x, y := a.Interface().(time.Time), b.Interface().(time.Time)
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String()), true
+	case reflect.Bool:
+		if a.Bool() == b.Bool() {
+			return 0, true
+		}
+		return 1, true
+	}
+	x, ok := size(a)
+	if !ok || a.Kind() == reflect.Slice || a.Kind() == reflect.Map || a.Kind() == reflect.Array {
+		return 0, false
+	}
+	y, _ := size(b)
+	switch {
+	case x < y:
+		return -1, true
+	case x > y:
+		return 1, true
+	}
+	return 0, true
+}
+
+// ValidationError 是一个字段的校验错误，可以直接作为 RespJSON 的响应体
+type ValidationError struct {
+	// Field 是字段名，嵌套结构体的字段用 . 连接，切片的元素用 [i] 表示
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return "web: 字段校验失败: " + e.Message
+}
+
+// ValidationErrors 是 Validate 收集到的所有字段的校验错误
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, ve := range e {
+		msgs = append(msgs, ve.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validateAddress struct {
+	City string `validate:"required"`
+}
+
+type validateUser struct {
+	Name      string    `validate:"required,min=3,max=8"`
+	Email     string    `validate:"omitempty,email"`
+	Role      string    `validate:"oneof=admin user"`
+	Age       *int      `validate:"omitempty,min=18"`
+	Password  string    `validate:"required"`
+	Confirm   string    `validate:"eqfield=Password"`
+	Start     time.Time `validate:"required"`
+	End       time.Time `validate:"gtfield=Start"`
+	Tags      []string  `validate:"max=2"`
+	Address   validateAddress
+	Addresses []validateAddress
+	Code      string `validate:"even"`
+}
+
+func TestValidate(t *testing.T) {
+	RegisterValidator("even", func(field reflect.Value, param string, parent reflect.Value) bool {
+		return len(field.String())%2 == 0
+	})
+	now := time.Now()
+	age := 17
+	valid := validateUser{
+		Name:      "tom",
+		Email:     "tom@example.com",
+		Role:      "admin",
+		Password:  "123",
+		Confirm:   "123",
+		Start:     now,
+		End:       now.Add(time.Hour),
+		Address:   validateAddress{City: "shanghai"},
+		Addresses: []validateAddress{{City: "beijing"}},
+		Code:      "ab",
+	}
+
+	testCases := []struct {
+		name    string
+		modify  func(u *validateUser)
+		wantErr ValidationErrors
+	}{
+		{
+			name:   "valid",
+			modify: func(u *validateUser) {},
+		},
+		{
+			name: "required and min",
+			modify: func(u *validateUser) {
+				u.Name = "to"
+				u.Password = ""
+				u.Confirm = ""
+			},
+			wantErr: ValidationErrors{
+				{Field: "Name", Rule: "min", Param: "3", Message: "Name 不能小于 3"},
+				{Field: "Password", Rule: "required", Message: "Password 不能为空"},
+			},
+		},
+		{
+			name: "email oneof and pointer",
+			modify: func(u *validateUser) {
+				u.Email = "tom"
+				u.Role = "root"
+				u.Age = &age
+				u.Tags = []string{"a", "b", "c"}
+			},
+			wantErr: ValidationErrors{
+				{Field: "Email", Rule: "email", Message: "Email 不是合法的邮箱地址"},
+				{Field: "Role", Rule: "oneof", Param: "admin user", Message: "Role 必须是 [admin user] 中的一个"},
+				{Field: "Age", Rule: "min", Param: "18", Message: "Age 不能小于 18"},
+				{Field: "Tags", Rule: "max", Param: "2", Message: "Tags 不能大于 2"},
+			},
+		},
+		{
+			name: "cross field",
+			modify: func(u *validateUser) {
+				u.Confirm = "456"
+				u.End = u.Start
+			},
+			wantErr: ValidationErrors{
+				{Field: "Confirm", Rule: "eqfield", Param: "Password", Message: "Confirm 必须等于 Password"},
+				{Field: "End", Rule: "gtfield", Param: "Start", Message: "End 必须大于 Start"},
+			},
+		},
+		{
+			name: "nested and custom",
+			modify: func(u *validateUser) {
+				u.Address.City = ""
+				u.Addresses = append(u.Addresses, validateAddress{})
+				u.Code = "abc"
+			},
+			wantErr: ValidationErrors{
+				{Field: "Address.City", Rule: "required", Message: "Address.City 不能为空"},
+				{Field: "Addresses[1].City", Rule: "required", Message: "Addresses[1].City 不能为空"},
+				{Field: "Code", Rule: "even", Message: "Code 不满足校验规则 even"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := valid
+			u.Addresses = append([]validateAddress(nil), valid.Addresses...)
+			tc.modify(&u)
+			err := Validate(&u)
+			if tc.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Equal(t, tc.wantErr, err)
+		})
+	}
+
+}
+
+func TestValidate_InvalidTag(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"abc"`
+	}
+	type badParam struct {
+		Name string `validate:"min=a"`
+	}
+	type missingField struct {
+		Name string `validate:"eqfield=Other"`
+	}
+	testCases := []struct {
+		name    string
+		val     any
+		wantErr string
+	}{
+		{
+			name:    "unknown rule",
+			val:     unknownRule{},
+			wantErr: "web: 字段 unknownRule.Name 使用了未知的校验规则 [abc]",
+		},
+		{
+			name:    "bad param",
+			val:     &badParam{},
+			wantErr: "web: 字段 badParam.Name 的校验规则 min 的参数 a 不是数字",
+		},
+		{
+			name:    "missing field",
+			val:     []missingField{{}},
+			wantErr: "web: 字段 missingField.Name 的校验规则 eqfield 引用的字段 Other 不存在",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.EqualError(t, Validate(tc.val), tc.wantErr)
+			// 检查结果被缓存之后依旧返回同样的错误
+			assert.EqualError(t, Validate(tc.val), tc.wantErr)
+		})
+	}
+}
+
+func TestContext_BindJSON_Validate(t *testing.T) {
+	s := NewHTTPServer()
+	s.Post("/user", func(ctx *Context) {
+		var req struct {
+			Name string `json:"name" validate:"required,min=3"`
+		}
+		if err := ctx.BindJSON(&req); err != nil {
+			ctx.RespStatusCode = http.StatusBadRequest
+			return
+		}
+		if err := Validate(&req); err != nil {
+			_ = ctx.RespJSON(http.StatusUnprocessableEntity, err)
+			return
+		}
+		ctx.RespData = []byte(req.Name)
+	})
+	// BindJSON 本身不校验，其它校验库的标签不会影响解析
+	s.Post("/other", func(ctx *Context) {
+		var req struct {
+			Age int `json:"age" validate:"gte=0"`
+		}
+		if err := ctx.BindJSON(&req); err != nil {
+			ctx.RespStatusCode = http.StatusBadRequest
+			return
+		}
+		ctx.RespData = []byte(strconv.Itoa(req.Age))
+	})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(`{"name":"to"}`)))
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	var errs []map[string]string
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errs))
+	assert.Equal(t, []map[string]string{
+		{"field": "Name", "rule": "min", "param": "3", "message": "Name 不能小于 3"},
+	}, errs)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(`{"name":"tom"}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "tom", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/other", strings.NewReader(`{"age":18}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "18", recorder.Body.String())
+}
@@ -0,0 +1,246 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrKeyNotExist 表示参数不存在
+var ErrKeyNotExist = errors.New("web: key not exist")
+
+// Value 是请求中的一个参数，由 Context 的 Query、Form、Path 和 Header 返回
+// 参数可以有多个值，除了 Strings 以外的方法都只使用第一个值。
+// 转换方法返回的错误是 *ValueError，参数不存在的时候可以用 errors.Is(err, ErrKeyNotExist) 判断；
+// AsXxxOr 方法在参数不存在或者转换失败的时候返回默认值
+type Value struct {
+	source string
+	key    string
+	vals   []string
+}
+
+// Query 返回查询参数，查询参数只会被解析一次
+func (c *Context) Query(key string) Value {
+	return Value{source: "query", key: key, vals: c.sourceValues("query", key)}
+}
+
+// Form 返回表单参数，包括查询参数和 x-www-form-urlencoded、multipart/form-data 的请求体，
+// 表单只会被解析一次，解析失败的时候当作参数不存在
+func (c *Context) Form(key string) Value {
+	return Value{source: "form", key: key, vals: c.sourceValues("form", key)}
+}
+
+// Path 返回路径参数
+func (c *Context) Path(key string) Value {
+	return Value{source: "path", key: key, vals: c.sourceValues("path", key)}
+}
+
+// Header 返回请求头
+func (c *Context) Header(key string) Value {
+	return Value{source: "header", key: key, vals: c.sourceValues("header", key)}
+}
+
+// Exists 判断参数是否存在
+func (v Value) Exists() bool {
+	return len(v.vals) > 0
+}
+
+// String 返回第一个值，参数不存在的时候返回空字符串
+func (v Value) String() string {
+	if len(v.vals) == 0 {
+		return ""
+	}
+	return v.vals[0]
+}
+
+// StringOr 返回第一个值，参数不存在的时候返回 def
+func (v Value) StringOr(def string) string {
+	if len(v.vals) == 0 {
+		return def
+	}
+	return v.vals[0]
+}
+
+// Strings 返回所有的值，返回的切片不能修改
+func (v Value) Strings() []string {
+	return v.vals
+}
+
+func (v Value) Int() (int, error) {
+	if len(v.vals) == 0 {
+		return 0, v.convErr("int", ErrKeyNotExist)
+	}
+	val, err := strconv.Atoi(v.vals[0])
+	if err != nil {
+		return 0, v.convErr("int", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsIntOr(def int) int {
+	val, err := v.Int()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+func (v Value) Int64() (int64, error) {
+	if len(v.vals) == 0 {
+		return 0, v.convErr("int64", ErrKeyNotExist)
+	}
+	val, err := strconv.ParseInt(v.vals[0], 10, 64)
+	if err != nil {
+		return 0, v.convErr("int64", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsInt64Or(def int64) int64 {
+	val, err := v.Int64()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+func (v Value) Uint64() (uint64, error) {
+	if len(v.vals) == 0 {
+		return 0, v.convErr("uint64", ErrKeyNotExist)
+	}
+	val, err := strconv.ParseUint(v.vals[0], 10, 64)
+	if err != nil {
+		return 0, v.convErr("uint64", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsUint64Or(def uint64) uint64 {
+	val, err := v.Uint64()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+func (v Value) Float64() (float64, error) {
+	if len(v.vals) == 0 {
+		return 0, v.convErr("float64", ErrKeyNotExist)
+	}
+	val, err := strconv.ParseFloat(v.vals[0], 64)
+	if err != nil {
+		return 0, v.convErr("float64", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsFloat64Or(def float64) float64 {
+	val, err := v.Float64()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// Bool 按照 strconv.ParseBool 解析，支持 1、t、true、0、f、false 等
+func (v Value) Bool() (bool, error) {
+	if len(v.vals) == 0 {
+		return false, v.convErr("bool", ErrKeyNotExist)
+	}
+	val, err := strconv.ParseBool(v.vals[0])
+	if err != nil {
+		return false, v.convErr("bool", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsBoolOr(def bool) bool {
+	val, err := v.Bool()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// Time 按照 layout 解析时间，layout 为空的时候使用 RFC3339，unix 表示秒级时间戳
+func (v Value) Time(layout string) (time.Time, error) {
+	if len(v.vals) == 0 {
+		return time.Time{}, v.convErr("time.Time", ErrKeyNotExist)
+	}
+	val, err := parseTime(v.vals[0], layout)
+	if err != nil {
+		return time.Time{}, v.convErr("time.Time", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsTimeOr(layout string, def time.Time) time.Time {
+	val, err := v.Time(layout)
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// Duration 按照 time.ParseDuration 解析，例如 1m30s
+func (v Value) Duration() (time.Duration, error) {
+	if len(v.vals) == 0 {
+		return 0, v.convErr("time.Duration", ErrKeyNotExist)
+	}
+	val, err := time.ParseDuration(v.vals[0])
+	if err != nil {
+		return 0, v.convErr("time.Duration", err)
+	}
+	return val, nil
+}
+
+func (v Value) AsDurationOr(def time.Duration) time.Duration {
+	val, err := v.Duration()
+	if err != nil {
+		return def
+	}
+	return val
+}
+
+// Ints 把所有的值转换成 int，任何一个值转换失败都会返回错误
+func (v Value) Ints() ([]int, error) {
+	res := make([]int, 0, len(v.vals))
+	for _, s := range v.vals {
+		val, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, v.convErr("[]int", err)
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+func (v Value) convErr(typ string, err error) *ValueError {
+	return &ValueError{Source: v.source, Key: v.key, Value: strings.Join(v.vals, ","), Type: typ, Err: err}
+}
+
+// ValueError 是 Value 的转换错误
+type ValueError struct {
+	// Source 是参数的来源：path、query、form 或者 header
+	Source string
+	// Key 是参数的名字
+	Key string
+	// Value 是参数的值，多个值用 , 连接
+	Value string
+	// Type 是目标类型
+	Type string
+	Err  error
+}
+
+func (e *ValueError) Error() string {
+	if errors.Is(e.Err, ErrKeyNotExist) {
+		return fmt.Sprintf("web: %s 参数 %s 不存在", e.Source, e.Key)
+	}
+	return fmt.Sprintf("web: %s 参数 %s 的值 %s 无法转换为 %s: %v", e.Source, e.Key, e.Value, e.Type, e.Err)
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContext_Value(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/user/42?page=2&ids=1&ids=2&bad=x&active=true&at=2022-12-01T10:00:00Z&ttl=1m30s",
+		strings.NewReader("size=20&name=tom"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Ratio", "0.5")
+	ctx := &Context{Req: req, PathParams: Params{{Key: "id", Value: "42"}}}
+
+	page, err := ctx.Query("page").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 2, page)
+	assert.Equal(t, int64(1), ctx.Query("missing").AsInt64Or(1))
+	assert.Equal(t, int64(1), ctx.Query("bad").AsInt64Or(1))
+	assert.Equal(t, []string{"1", "2"}, ctx.Query("ids").Strings())
+	ids, err := ctx.Query("ids").Ints()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+	active, err := ctx.Query("active").Bool()
+	require.NoError(t, err)
+	assert.True(t, active)
+	at, err := ctx.Query("at").Time("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 12, 1, 10, 0, 0, 0, time.UTC), at)
+	assert.Equal(t, 90*time.Second, ctx.Query("ttl").AsDurationOr(0))
+
+	assert.Equal(t, "tom", ctx.Form("name").String())
+	assert.Equal(t, "2", ctx.Form("page").String())
+	assert.Equal(t, 20, ctx.Form("size").AsIntOr(10))
+	assert.Equal(t, "guest", ctx.Form("role").StringOr("guest"))
+
+	id, err := ctx.Path("id").Uint64()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), id)
+	assert.False(t, ctx.Path("name").Exists())
+
+	assert.Equal(t, 0.5, ctx.Header("X-Ratio").AsFloat64Or(1))
+	assert.Equal(t, "", ctx.Header("X-Missing").String())
+
+	// 查询参数和表单只解析一次
+	ctx.Req.URL.RawQuery = "page=3"
+	ctx.Req.Form.Set("name", "jerry")
+	assert.Equal(t, 2, ctx.Query("page").AsIntOr(0))
+	name, err := ctx.FormValue("name")
+	require.NoError(t, err)
+	assert.Equal(t, "jerry", name)
+}
+
+func TestValue_Errors(t *testing.T) {
+	ctx := &Context{Req: httptest.NewRequest(http.MethodGet, "/?ids=1&ids=x&page=abc", nil)}
+
+	_, err := ctx.Query("page").Int()
+	assert.EqualError(t, err, `web: query 参数 page 的值 abc 无法转换为 int: strconv.Atoi: parsing "abc": invalid syntax`)
+	var ve *ValueError
+	require.True(t, errors.As(err, &ve))
+	assert.Equal(t, "page", ve.Key)
+
+	_, err = ctx.Query("ids").Ints()
+	assert.EqualError(t, err, `web: query 参数 ids 的值 1,x 无法转换为 []int: strconv.Atoi: parsing "x": invalid syntax`)
+
+	_, err = ctx.Query("size").Bool()
+	assert.EqualError(t, err, "web: query 参数 size 不存在")
+	assert.True(t, errors.Is(err, ErrKeyNotExist))
+
+	_, err = ctx.Header("X-Deadline").Time(time.RFC1123)
+	assert.True(t, errors.Is(err, ErrKeyNotExist))
+
+	_, err = ctx.QueryValue("size")
+	assert.Equal(t, ErrKeyNotExist, err)
+}
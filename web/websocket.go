@@ -0,0 +1,533 @@
+package web
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket 消息类型，和 RFC 6455 中的 opcode 一致
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// WebSocket 关闭码，见 RFC 6455 7.4.1
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+// websocketGUID 用于计算 Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultMaxMessageSize 是默认允许读取的最大消息，避免恶意的客户端耗尽内存
+const defaultMaxMessageSize = 32 << 20
+
+// WSHandler 处理升级之后的 WebSocket 连接
+// WSHandler 返回之后连接会被关闭
+type WSHandler func(conn *WSConn)
+
+// WSOption 是 WebSocket 路由的选项
+type WSOption func(u *wsUpgrader)
+
+type wsUpgrader struct {
+	// checkOrigin 返回 false 的时候拒绝握手，响应 403
+	checkOrigin func(req *http.Request) bool
+}
+
+// WSWithCheckOrigin 自定义 Origin 的校验
+// 默认只允许没有 Origin 的请求和同源的请求，
+// 否则别的网站的页面可以带着用户的 cookie 建立连接（跨站 WebSocket 劫持）
+func WSWithCheckOrigin(fn func(req *http.Request) bool) WSOption {
+	return func(u *wsUpgrader) {
+		u.checkOrigin = fn
+	}
+}
+
+// WebSocket 注册 WebSocket 路由
+// 路由上的 middleware 在升级之前执行，可以用来做鉴权，
+// middleware 没有调用后续的 handler 的时候不会升级，响应由 middleware 决定
+func (s *HTTPServer) WebSocket(path string, handler WSHandler, opts ...WSOption) *Route {
+	return s.Get(path, upgradeHandler(handler, opts))
+}
+
+// WebSocket 在分组内注册 WebSocket 路由
+func (g *RouteGroup) WebSocket(path string, handler WSHandler, opts ...WSOption) *Route {
+	return g.Get(path, upgradeHandler(handler, opts))
+}
+
+func upgradeHandler(handler WSHandler, opts []WSOption) HandleFunc {
+	u := &wsUpgrader{checkOrigin: sameOrigin}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return func(ctx *Context) {
+		conn, err := u.upgrade(ctx)
+		if err != nil {
+			return
+		}
+		defer conn.Close(CloseNormalClosure, "")
+		handler(conn)
+	}
+}
+
+// sameOrigin 判断 Origin 和 Host 是否一致，没有 Origin 的请求不是浏览器发出的，直接放行
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, req.Host)
+}
+
+// upgrade 完成 RFC 6455 的握手
+// 握手失败的时候设置好响应并返回 error
+func (u *wsUpgrader) upgrade(ctx *Context) (*WSConn, error) {
+	req := ctx.Req
+	if req.Method != http.MethodGet ||
+		!headerContainsToken(req.Header, "Connection", "upgrade") ||
+		!headerContainsToken(req.Header, "Upgrade", "websocket") {
+		ctx.RespStatusCode = http.StatusBadRequest
+		ctx.RespData = []byte("web: 不是合法的 WebSocket 握手请求")
+		return nil, errors.New("web: 不是合法的 WebSocket 握手请求")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		ctx.Resp.Header().Set("Sec-WebSocket-Version", "13")
+		ctx.RespStatusCode = http.StatusUpgradeRequired
+		ctx.RespData = []byte("web: 不支持的 WebSocket 版本")
+		return nil, errors.New("web: 不支持的 WebSocket 版本")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		ctx.RespStatusCode = http.StatusBadRequest
+		ctx.RespData = []byte("web: 非法的 Sec-WebSocket-Key")
+		return nil, errors.New("web: 非法的 Sec-WebSocket-Key")
+	}
+	if !u.checkOrigin(req) {
+		ctx.RespStatusCode = http.StatusForbidden
+		ctx.RespData = []byte("web: 不允许的 Origin")
+		return nil, errors.New("web: 不允许的 Origin")
+	}
+
+	hj, ok := ctx.Resp.(http.Hijacker)
+	if !ok {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return nil, errors.New("web: http.ResponseWriter 不支持 Hijack")
+	}
+	// middleware 设置的响应头，例如 Set-Cookie，需要跟着握手响应一起发出去
+	header := ctx.Resp.Header().Clone()
+	netConn, rw, err := hj.Hijack()
+	if err != nil {
+		ctx.RespStatusCode = http.StatusInternalServerError
+		return nil, err
+	}
+	// 清理 http.Server 设置的超时，之后由 WSConn 的使用者自己控制
+	_ = netConn.SetDeadline(time.Time{})
+
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", computeAcceptKey(key))
+	header.Del("Content-Length")
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	_ = header.Write(rw)
+	_, _ = rw.WriteString("\r\n")
+	if err = rw.Flush(); err != nil {
+		_ = netConn.Close()
+		return nil, err
+	}
+	return &WSConn{
+		ctx:            ctx,
+		conn:           netConn,
+		br:             rw.Reader,
+		MaxMessageSize: defaultMaxMessageSize,
+		dataSem:        make(chan struct{}, 1),
+		closed:         make(chan struct{}),
+	}, nil
+}
+
+func computeAcceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContainsToken 判断逗号分隔的头部字段中是否有 token，忽略大小写
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, val := range header.Values(name) {
+		for _, t := range strings.Split(val, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CloseError 表示对端发送了关闭帧，或者因为协议错误关闭了连接
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("web: WebSocket 连接关闭，关闭码 %d，原因 %s", e.Code, e.Reason)
+}
+
+// errWSClosed 表示连接已经关闭
+var errWSClosed = errors.New("web: WebSocket 连接已经关闭")
+
+// WSConn 是升级之后的 WebSocket 连接
+// 读只能在一个 goroutine 中进行；写可以并发，但是 NextWriter 返回的分片写入器
+// 在 Close 之前独占数据帧的写入。控制帧可以插在分片之间，所以 Ping、Pong 和 Close
+// 不会被没有关闭的分片写入器阻塞
+type WSConn struct {
+	ctx  *Context
+	conn net.Conn
+	br   *bufio.Reader
+
+	// MaxMessageSize 是允许读取的最大消息字节数，超过的时候以 1009 关闭连接
+	MaxMessageSize int64
+
+	// frameMu 保证一帧完整地写出
+	frameMu sync.Mutex
+	// dataSem 是数据消息的写入权，分片写入器在 Close 之前一直持有
+	dataSem chan struct{}
+	// closed 在 Close 的时候关闭，唤醒等待写入权的 goroutine
+	closed chan struct{}
+	// closeSent 表示已经发送了关闭帧，之后不能再发送任何帧
+	closeSent bool
+	closeOnce sync.Once
+}
+
+// Context 返回升级之前的请求上下文，可以读取 middleware 写入的 UserValues
+// 只能在 WSHandler 返回之前使用
+func (c *WSConn) Context() *Context {
+	return c.ctx
+}
+
+// SetReadDeadline 设置读取的超时时间
+func (c *WSConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline 设置写入的超时时间
+func (c *WSConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage 读取一条完整的消息，分片的消息会被拼接起来
+// Ping 会被自动回复 Pong，Pong 会被忽略；
+// 收到关闭帧的时候会回复关闭帧，并且返回 *CloseError
+func (c *WSConn) ReadMessage() (int, []byte, error) {
+	msgType := 0
+	var msg []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch opcode {
+		case PingMessage:
+			if err = c.writeFrame(true, PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			return 0, nil, c.handleClose(payload)
+		case TextMessage, BinaryMessage:
+			if msgType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "分片消息没有结束")
+			}
+			msgType, msg = opcode, payload
+		case continuationFrame:
+			if msgType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "没有需要继续的分片消息")
+			}
+			msg = append(msg, payload...)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, fmt.Sprintf("未知的 opcode %d", opcode))
+		}
+
+		if c.MaxMessageSize > 0 && int64(len(msg)) > c.MaxMessageSize {
+			return 0, nil, c.fail(CloseMessageTooBig, "消息太大")
+		}
+		if !fin {
+			continue
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(CloseInvalidPayload, "文本消息不是合法的 UTF-8")
+		}
+		return msgType, msg, nil
+	}
+}
+
+// readFrame 读取一帧，客户端发送的帧必须有掩码
+func (c *WSConn) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := int(head[0] & 0x0f)
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "没有协商扩展，RSV 必须为 0")
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "客户端发送的帧必须有掩码")
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length>>63 != 0 {
+			return false, 0, nil, c.fail(CloseProtocolError, "帧长度的最高位必须为 0")
+		}
+	}
+	if opcode >= CloseMessage && (!fin || length > 125) {
+		return false, 0, nil, c.fail(CloseProtocolError, "控制帧不能分片，长度不能超过 125")
+	}
+	if c.MaxMessageSize > 0 && length > uint64(c.MaxMessageSize) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "消息太大")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// handleClose 处理对端发送的关闭帧：回复同样的关闭码，然后关闭连接
+func (c *WSConn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "关闭帧的长度不能为 1")
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.fail(CloseProtocolError, fmt.Sprintf("非法的关闭码 %d", closeErr.Code))
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.fail(CloseInvalidPayload, "关闭原因不是合法的 UTF-8")
+		}
+	}
+	code := closeErr.Code
+	if code == CloseNoStatusReceived {
+		code = CloseNormalClosure
+	}
+	_ = c.Close(code, "")
+	return closeErr
+}
+
+// validCloseCode 判断对端发送的关闭码是否合法，见 RFC 6455 7.4
+// 1004、1005、1006 和 1015 是保留的，不能出现在关闭帧中；
+// 1016 ~ 2999 留给以后的协议扩展，3000 ~ 4999 留给库和应用使用
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail 因为协议错误关闭连接
+func (c *WSConn) fail(code int, reason string) error {
+	_ = c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage 用一帧发送一条消息
+func (c *WSConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return c.writeControl(messageType, data)
+	}
+	if err := c.acquireData(); err != nil {
+		return err
+	}
+	defer c.releaseData()
+	return c.writeFrame(true, messageType, data)
+}
+
+// acquireData 获取数据消息的写入权，连接关闭之后返回 error
+func (c *WSConn) acquireData() error {
+	select {
+	case <-c.closed:
+		return errWSClosed
+	default:
+	}
+	select {
+	case c.dataSem <- struct{}{}:
+		return nil
+	case <-c.closed:
+		return errWSClosed
+	}
+}
+
+func (c *WSConn) releaseData() {
+	<-c.dataSem
+}
+
+// Ping 发送 Ping 帧，data 不能超过 125 字节
+func (c *WSConn) Ping(data []byte) error {
+	return c.writeControl(PingMessage, data)
+}
+
+func (c *WSConn) writeControl(opcode int, data []byte) error {
+	if opcode != PingMessage && opcode != PongMessage {
+		return fmt.Errorf("web: 不支持的 WebSocket 消息类型 %d", opcode)
+	}
+	if len(data) > 125 {
+		return errors.New("web: 控制帧的长度不能超过 125")
+	}
+	return c.writeFrame(true, opcode, data)
+}
+
+// NextWriter 返回分片发送一条消息的写入器，每次 Write 发送一个分片，
+// Close 发送最后一个分片；Close 之前其它数据消息的写入会被阻塞
+func (c *WSConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, fmt.Errorf("web: 只有文本消息和二进制消息可以分片，消息类型 %d", messageType)
+	}
+	if err := c.acquireData(); err != nil {
+		return nil, err
+	}
+	return &wsFragmentWriter{c: c, opcode: messageType}, nil
+}
+
+type wsFragmentWriter struct {
+	c      *WSConn
+	opcode int
+	closed bool
+}
+
+func (w *wsFragmentWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("web: 分片写入器已经关闭")
+	}
+	if err := w.c.writeFrame(false, w.opcode, p); err != nil {
+		return 0, err
+	}
+	w.opcode = continuationFrame
+	return len(p), nil
+}
+
+func (w *wsFragmentWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.c.releaseData()
+	return w.c.writeFrame(true, w.opcode, nil)
+}
+
+// Close 发送关闭帧并关闭底层连接，重复调用没有影响
+// 分片写入器没有关闭的时候也可以调用，之后分片写入器的写入会返回 error
+// WSHandler 返回之后会自动以 1000 关闭
+func (c *WSConn) Close(code int, reason string) error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		// 控制帧不能超过 125 字节，截断原因的时候不能把一个字符截成两半
+		if len(reason) > 123 {
+			n := 123
+			for n > 0 && !utf8.RuneStart(reason[n]) {
+				n--
+			}
+			reason = reason[:n]
+		}
+		payload := make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+		// 正在写入的帧最多再阻塞一秒，之后 frameMu 一定会被释放
+		_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = c.writeFrame(true, CloseMessage, payload)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+func (c *WSConn) writeFrame(fin bool, opcode int, data []byte) error {
+	c.frameMu.Lock()
+	defer c.frameMu.Unlock()
+	return c.writeFrameLocked(fin, opcode, data)
+}
+
+// writeFrameLocked 写入一帧，服务端发送的帧没有掩码
+func (c *WSConn) writeFrameLocked(fin bool, opcode int, data []byte) error {
+	if c.closeSent {
+		return errWSClosed
+	}
+	buf := make([]byte, 0, 10+len(data))
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+	switch l := len(data); {
+	case l <= 125:
+		buf = append(buf, byte(l))
+	case l <= 0xffff:
+		buf = append(buf, 126, byte(l>>8), byte(l))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(l))
+		buf = append(append(buf, 127), ext[:]...)
+	}
+	buf = append(buf, data...)
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+	_, err := c.conn.Write(buf)
+	return err
+}
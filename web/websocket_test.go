@@ -0,0 +1,309 @@
+package web
+
+import (
+	"bufio"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestComputeAcceptKey(t *testing.T) {
+	// RFC 6455 1.3 中的例子
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", computeAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestHTTPServer_WebSocket(t *testing.T) {
+	s := NewHTTPServer()
+	s.Use(http.MethodGet, "/ws", func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			if ctx.Req.URL.Query().Get("token") != "secret" {
+				ctx.RespStatusCode = http.StatusUnauthorized
+				return
+			}
+			ctx.Resp.Header().Set("Set-Cookie", "session=1")
+			ctx.UserValues = map[string]interface{}{"user": "tom"}
+			next(ctx)
+		}
+	})
+	s.WebSocket("/ws", func(conn *WSConn) {
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(data) == "who" {
+				data = []byte(conn.Context().UserValues["user"].(string))
+			}
+			if err = conn.WriteMessage(typ, data); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/ws")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("bad handshake", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/ws?token=secret")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("echo", func(t *testing.T) {
+		c := dialWS(t, server.Listener.Addr().String(), "/ws?token=secret")
+		defer c.conn.Close()
+		assert.Equal(t, "session=1", c.header.Get("Set-Cookie"))
+
+		c.writeFrame(t, true, TextMessage, []byte("hello"))
+		fin, op, data := c.readFrame(t)
+		assert.True(t, fin)
+		assert.Equal(t, TextMessage, op)
+		assert.Equal(t, "hello", string(data))
+
+		c.writeFrame(t, true, BinaryMessage, []byte{1, 2, 3})
+		_, op, data = c.readFrame(t)
+		assert.Equal(t, BinaryMessage, op)
+		assert.Equal(t, []byte{1, 2, 3}, data)
+
+		c.writeFrame(t, true, TextMessage, []byte("who"))
+		_, _, data = c.readFrame(t)
+		assert.Equal(t, "tom", string(data))
+
+		// 分片消息中间插入 Ping
+		c.writeFrame(t, false, TextMessage, []byte("frag"))
+		c.writeFrame(t, true, PingMessage, []byte("p"))
+		_, op, data = c.readFrame(t)
+		assert.Equal(t, PongMessage, op)
+		assert.Equal(t, "p", string(data))
+		c.writeFrame(t, false, continuationFrame, []byte("men"))
+		c.writeFrame(t, true, continuationFrame, []byte("ted"))
+		_, op, data = c.readFrame(t)
+		assert.Equal(t, TextMessage, op)
+		assert.Equal(t, "fragmented", string(data))
+
+		// 大于 125 字节的消息使用扩展长度
+		long := strings.Repeat("a", 70000)
+		c.writeFrame(t, true, TextMessage, []byte(long))
+		_, _, data = c.readFrame(t)
+		assert.Equal(t, long, string(data))
+
+		c.writeFrame(t, true, CloseMessage, []byte{0x03, 0xe8})
+		_, op, data = c.readFrame(t)
+		assert.Equal(t, CloseMessage, op)
+		assert.Equal(t, CloseNormalClosure, int(binary.BigEndian.Uint16(data)))
+	})
+
+	t.Run("protocol error", func(t *testing.T) {
+		c := dialWS(t, server.Listener.Addr().String(), "/ws?token=secret")
+		defer c.conn.Close()
+		c.writeFrame(t, true, continuationFrame, []byte("oops"))
+		_, op, data := c.readFrame(t)
+		assert.Equal(t, CloseMessage, op)
+		assert.Equal(t, CloseProtocolError, int(binary.BigEndian.Uint16(data)))
+	})
+
+	t.Run("reserved close code", func(t *testing.T) {
+		c := dialWS(t, server.Listener.Addr().String(), "/ws?token=secret")
+		defer c.conn.Close()
+		// 1006 只能在本地表示连接异常断开，不能出现在关闭帧中
+		c.writeFrame(t, true, CloseMessage, []byte{0x03, 0xee})
+		_, op, data := c.readFrame(t)
+		assert.Equal(t, CloseMessage, op)
+		assert.Equal(t, CloseProtocolError, int(binary.BigEndian.Uint16(data)))
+	})
+
+	t.Run("invalid utf8", func(t *testing.T) {
+		c := dialWS(t, server.Listener.Addr().String(), "/ws?token=secret")
+		defer c.conn.Close()
+		c.writeFrame(t, true, TextMessage, []byte{0xff, 0xfe})
+		_, op, data := c.readFrame(t)
+		assert.Equal(t, CloseMessage, op)
+		assert.Equal(t, CloseInvalidPayload, int(binary.BigEndian.Uint16(data)))
+	})
+}
+
+func TestHTTPServer_WebSocket_Origin(t *testing.T) {
+	s := NewHTTPServer()
+	handler := func(conn *WSConn) {}
+	s.WebSocket("/ws", handler)
+	s.WebSocket("/any", handler, WSWithCheckOrigin(func(req *http.Request) bool {
+		return true
+	}))
+	server := httptest.NewServer(s)
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	testCases := []struct {
+		name     string
+		path     string
+		origin   string
+		wantCode int
+	}{
+		{
+			name:     "no origin",
+			path:     "/ws",
+			wantCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:     "same origin",
+			path:     "/ws",
+			origin:   "http://" + addr,
+			wantCode: http.StatusSwitchingProtocols,
+		},
+		{
+			name:     "cross origin",
+			path:     "/ws",
+			origin:   "http://evil.com",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "custom check",
+			path:     "/any",
+			origin:   "http://evil.com",
+			wantCode: http.StatusSwitchingProtocols,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, resp := handshakeWS(t, addr, tc.path, tc.origin)
+			defer c.conn.Close()
+			assert.Equal(t, tc.wantCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestWSConn_CloseWithOpenWriter(t *testing.T) {
+	s := NewHTTPServer()
+	done := make(chan struct{})
+	s.WebSocket("/ws", func(conn *WSConn) {
+		defer close(done)
+		w, err := conn.NextWriter(TextMessage)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("part"))
+		require.NoError(t, err)
+		// 模拟出错的时候没有关闭分片写入器就返回
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := dialWS(t, server.Listener.Addr().String(), "/ws")
+	defer c.conn.Close()
+	fin, op, data := c.readFrame(t)
+	assert.False(t, fin)
+	assert.Equal(t, TextMessage, op)
+	assert.Equal(t, "part", string(data))
+	_, op, data = c.readFrame(t)
+	assert.Equal(t, CloseMessage, op)
+	assert.Equal(t, CloseNormalClosure, int(binary.BigEndian.Uint16(data)))
+	<-done
+}
+
+func TestWSConn_CloseLongReason(t *testing.T) {
+	s := NewHTTPServer()
+	s.WebSocket("/ws", func(conn *WSConn) {
+		_ = conn.Close(CloseGoingAway, strings.Repeat("中", 50))
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := dialWS(t, server.Listener.Addr().String(), "/ws")
+	defer c.conn.Close()
+	_, op, data := c.readFrame(t)
+	assert.Equal(t, CloseMessage, op)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(data)))
+	// 123 字节以内最多放下 41 个三字节的字符
+	assert.Equal(t, strings.Repeat("中", 41), string(data[2:]))
+}
+
+// wsTestClient 是测试用的最简单的 WebSocket 客户端
+type wsTestClient struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	header http.Header
+}
+
+func dialWS(t *testing.T, addr string, path string) *wsTestClient {
+	c, resp := handshakeWS(t, addr, path, "")
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+	return c
+}
+
+// handshakeWS 发送握手请求，origin 不为空的时候带上 Origin 头部
+func handshakeWS(t *testing.T, addr string, path string, origin string) (*wsTestClient, *http.Response) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	req := "GET " + path + " HTTP/1.1\r\nHost: " + addr + "\r\n" +
+		"Upgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+	if origin != "" {
+		req += "Origin: " + origin + "\r\n"
+	}
+	_, err = conn.Write([]byte(req + "\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	return &wsTestClient{conn: conn, br: br, header: resp.Header}, resp
+}
+
+func (c *wsTestClient) writeFrame(t *testing.T, fin bool, opcode int, data []byte) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	buf := []byte{b0}
+	switch l := len(data); {
+	case l <= 125:
+		buf = append(buf, 0x80|byte(l))
+	case l <= 0xffff:
+		buf = append(buf, 0x80|126, byte(l>>8), byte(l))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(l))
+		buf = append(append(buf, 0x80|127), ext[:]...)
+	}
+	mask := []byte{1, 2, 3, 4}
+	buf = append(buf, mask...)
+	for i, b := range data {
+		buf = append(buf, b^mask[i%4])
+	}
+	_, err := c.conn.Write(buf)
+	require.NoError(t, err)
+}
+
+func (c *wsTestClient) readFrame(t *testing.T) (bool, int, []byte) {
+	var head [2]byte
+	_, err := io.ReadFull(c.br, head[:])
+	require.NoError(t, err)
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		require.NoError(t, err)
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.br, ext[:])
+		require.NoError(t, err)
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	data := make([]byte, length)
+	_, err = io.ReadFull(c.br, data)
+	require.NoError(t, err)
+	return head[0]&0x80 != 0, int(head[0] & 0x0f), data
+}